@@ -14,6 +14,7 @@ const (
 	FPS           = 10
 	MinPacketSize = 3
 	MaxPacketSize = KCPMtx * 4
+	MaxDetailSize = 128 // bytes of NetFinish.detail
 )
 
 var TimeZero = time.Time{}
@@ -24,8 +25,57 @@ const (
 	StartTimeout   = time.Second * 20
 	SyncLowLimit   = time.Second * 5
 	SyncHighLimit  = time.Second * 2
+	PeerTimeout    = time.Second * 1
+	PingInterval   = time.Second * 2
+
+	PauseBudget     = time.Second * 60 // per team
+	ResumeCountdown = time.Second * 3
+
+	InputDelayInterval = time.Second * 1
+	ProgressInterval   = time.Second * 1
+	LagLogInterval     = time.Second * 30
+
+	// bounds of the per room timeouts
+	MinTimeout        = time.Second * 1
+	MaxConnectTimeout = time.Minute * 5
+	MaxStartTimeout   = time.Minute * 10
+	MaxSyncLowLimit   = time.Second * 30
+	MaxSyncHighLimit  = time.Second * 10
+
+	SoftSyncDivisor   = 2 // soft sync limits for speed hints are the sync limits divided by it
+	SpeedHintInterval = time.Second * 1
+
+	VoteTimeout  = time.Second * 30
+	RemakeWindow = time.Minute * 3 // since room start
+)
+
+const (
+	MinInputDelay = 1  // frames
+	MaxInputDelay = 10 // frames
+
+	MaxVisibilityDelay = FPS * 10 // frames
+
+	LagWindowSize = FPS * 30 // lag samples of a player, 30s
+
+	ChannelSize    = KCPWindowSize * 8 // messages queued to a player
+	MaxQueuedBytes = 1024 * 1024       // queued messages and held commands of a player
 )
 
+// InputLimits bounds the input of a single player, zero or negative value means unlimited.
+type InputLimits struct {
+	BytesPerSecond    int
+	PacketsPerFrame   int
+	MaxPayloadSize    int
+	MessagesPerSecond int
+}
+
+var Limits = InputLimits{
+	BytesPerSecond:    MaxPacketSize * FPS * 2,
+	PacketsPerFrame:   8,
+	MaxPayloadSize:    1024,
+	MessagesPerSecond: 5,
+}
+
 var (
 	ErrUnexpected = errors.New("unexpected error")
 	ErrArguments  = errors.New("invalid arguments")
@@ -36,16 +86,29 @@ var (
 	ErrRoomNotFound = errors.New("room not found")
 	ErrRoomExisted  = errors.New("room existed")
 	ErrRoomState    = errors.New("invalid room state")
+	ErrModeNotFound = errors.New("game mode not found")
+	ErrPauseBudget  = errors.New("pause budget exhausted")
+	ErrPauseTeam    = errors.New("paused by another team")
+	ErrNoQuorum     = errors.New("quorum not reached")
+
+	ErrVoteExisted  = errors.New("vote existed")
+	ErrVoteNotFound = errors.New("vote not found")
 
 	ErrPlayerNotFound = errors.New("player not found")
 	ErrPlayerExisted  = errors.New("player existed")
 
+	ErrConvExisted   = errors.New("conv existed")
+	ErrConvExhausted = errors.New("conv exhausted")
+
+	ErrNodeUnreachable = errors.New("node unreachable")
+
 	// network borken
 	ErrNetworkBroken = errors.New("network broken")
 
 	// invalid packet
-	ErrPacketBroken = errors.New("packet is broken")    // remote message/packet
-	ErrPacketSize   = errors.New("invalid packet size") // remote message/packet
+	ErrPacketBroken   = errors.New("packet is broken")    // remote message/packet
+	ErrPacketSize     = errors.New("invalid packet size") // remote message/packet
+	ErrInvalidCommand = errors.New("invalid command")     // remote command payload
 
 	// auth failed
 	ErrAuthFailed = errors.New("authorization failed")
@@ -56,6 +119,15 @@ var (
 	// data out of sync
 	ErrDataOutOfSync = errors.New("data out of sync")
 
+	// input flood
+	ErrInputFlood = errors.New("input flood")
+
+	// surrender
+	ErrSurrender = errors.New("surrender")
+
+	// slow receiver
+	ErrSlowReceiver = errors.New("slow receiver")
+
 	// other
 	ErrRemoteFinish = errors.New("remote finish")
 	ErrLocalFinish  = errors.New("local finish")
@@ -21,6 +21,36 @@ type errorTracer interface {
 	StackTrace() errors.StackTrace
 }
 
+// Logger receives formatted logs, the default one writes to logrus.
+type Logger interface {
+	Log(level int, fields LogFields, message string)
+}
+
+type logrusLogger struct{}
+
+func (logrusLogger) Log(level int, fields LogFields, message string) {
+	switch level {
+	case LevelError:
+		log.WithFields(fields).Error(message)
+	case LevelWarn:
+		log.WithFields(fields).Warn(message)
+	case LevelInfo:
+		log.WithFields(fields).Info(message)
+	case LevelDebug:
+		log.WithFields(fields).Debug(message)
+	}
+}
+
+var logger Logger = logrusLogger{}
+
+// SetLogger replaces the process wide logger, nil restores the default, call it before serving.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = logrusLogger{}
+	}
+	logger = l
+}
+
 func LogPrint(level int, fields log.Fields, args ...interface{}) {
 	if fields == nil {
 		fields = LogFields{}
@@ -35,26 +65,12 @@ func LogPrint(level int, fields log.Fields, args ...interface{}) {
 			}
 			fields["stack"] = stack
 
-			switch level {
-			case LevelError:
-				log.WithFields(fields).Error(err.Error())
-			case LevelWarn:
-				log.WithFields(fields).Warn(err.Error())
-			case LevelInfo:
-				log.WithFields(fields).Info(err.Error())
+			if level != LevelDebug {
+				logger.Log(level, fields, err.Error())
 			}
 			return
 		}
 	}
 
-	switch level {
-	case LevelError:
-		log.WithFields(fields).Error(fmt.Sprint(args...))
-	case LevelWarn:
-		log.WithFields(fields).Warn(fmt.Sprint(args...))
-	case LevelInfo:
-		log.WithFields(fields).Info(fmt.Sprint(args...))
-	case LevelDebug:
-		log.WithFields(fields).Debug(fmt.Sprint(args...))
-	}
+	logger.Log(level, fields, fmt.Sprint(args...))
 }
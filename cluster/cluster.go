@@ -0,0 +1,199 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	. "point-set/base"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ForwardedHeader marks a request forwarded by a peer, which handles it locally.
+// It's internal to the cluster, a gateway in front of the nodes should strip it.
+const ForwardedHeader = "X-Point-Set-Forwarded"
+
+type NodeStatus struct {
+	NodeId   uint32 `json:"node_id"`
+	KCPAddr  string `json:"kcp_addr"`
+	HTTPAddr string `json:"http_addr"`
+	Rooms    int    `json:"rooms"`
+	Players  int    `json:"players"`
+}
+
+type Cluster struct {
+	nodeId    uint32
+	kcpAddr   string
+	httpAddr  string
+	discovery Discovery
+	client    *http.Client
+}
+
+func NewCluster(nodeId uint32, kcpAddr string, httpAddr string, discovery Discovery) *Cluster {
+	if discovery == nil {
+		discovery = NewStaticDiscovery(nil)
+	}
+	return &Cluster{
+		nodeId:    nodeId,
+		kcpAddr:   kcpAddr,
+		httpAddr:  httpAddr,
+		discovery: discovery,
+		client:    &http.Client{Timeout: PeerTimeout},
+	}
+}
+
+func (c *Cluster) NodeId() uint32 {
+	return c.nodeId
+}
+
+func (c *Cluster) KCPAddr() string {
+	return c.kcpAddr
+}
+
+func (c *Cluster) HTTPAddr() string {
+	return c.httpAddr
+}
+
+func (c *Cluster) Status(rooms int, players int) *NodeStatus {
+	return &NodeStatus{
+		NodeId:   c.nodeId,
+		KCPAddr:  c.kcpAddr,
+		HTTPAddr: c.httpAddr,
+		Rooms:    rooms,
+		Players:  players,
+	}
+}
+
+func (c *Cluster) IsLocal(status *NodeStatus) bool {
+	return status.HTTPAddr == c.httpAddr
+}
+
+// Statuses collects the status of all reachable peers, local node excluded.
+func (c *Cluster) Statuses() []*NodeStatus {
+	peers, err := c.discovery.Peers()
+	if err != nil {
+		c.logWarn(nil, err)
+		return nil
+	}
+
+	wg := sync.WaitGroup{}
+	statuses := make([]*NodeStatus, len(peers))
+	for idx, peer := range peers {
+		if peer == c.httpAddr {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, peer string) {
+			defer wg.Done()
+			status, err := c.fetchStatus(peer)
+			if err != nil {
+				c.logWarn(LogFields{"peer": peer}, err)
+				return
+			}
+			statuses[idx] = status
+		}(idx, peer)
+	}
+	wg.Wait()
+
+	reachable := statuses[:0]
+	for _, status := range statuses {
+		if status != nil {
+			reachable = append(reachable, status)
+		}
+	}
+	return reachable
+}
+
+// Place picks the least loaded node, the local node wins on a tie.
+func (c *Cluster) Place(local *NodeStatus) *NodeStatus {
+	best := local
+	for _, status := range c.Statuses() {
+		if status.Players < best.Players ||
+			(status.Players == best.Players && status.Rooms < best.Rooms) {
+			best = status
+		}
+	}
+	return best
+}
+
+// Forward posts a JSON body to the node, returns the status code and body of the response.
+func (c *Cluster) Forward(httpAddr string, path string, body []byte) (int, []byte, error) {
+	url := fmt.Sprintf("http://%s%s", httpAddr, path)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ForwardedHeader, "1")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, errors.WithStack(errors.Wrap(ErrNodeUnreachable, err.Error()))
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, errors.WithStack(errors.Wrap(ErrNodeUnreachable, err.Error()))
+	}
+	return resp.StatusCode, data, nil
+}
+
+// IsForwarded returns true if the request is forwarded by a peer.
+func IsForwarded(r *http.Request) bool {
+	return r.Header.Get(ForwardedHeader) != ""
+}
+
+// Broadcast forwards the body to every peer, stops at the first one responding OK.
+func (c *Cluster) Broadcast(path string, body []byte) (int, []byte, error) {
+	peers, err := c.discovery.Peers()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	code, data := http.StatusNotFound, []byte(nil)
+	for _, peer := range peers {
+		if peer == c.httpAddr {
+			continue
+		}
+		peerCode, peerData, err := c.Forward(peer, path, body)
+		if err != nil {
+			c.logWarn(LogFields{"peer": peer}, err)
+			continue
+		}
+		if peerCode == http.StatusOK {
+			return peerCode, peerData, nil
+		}
+		code, data = peerCode, peerData
+	}
+	return code, data, nil
+}
+
+func (c *Cluster) fetchStatus(httpAddr string) (*NodeStatus, error) {
+	resp, err := c.client.Get(fmt.Sprintf("http://%s/node-status", httpAddr))
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrap(ErrNodeUnreachable, err.Error()))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(ErrNodeUnreachable, "status(%d)", resp.StatusCode)
+	}
+	status := &NodeStatus{}
+	err = json.NewDecoder(resp.Body).Decode(status)
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrap(ErrNodeUnreachable, err.Error()))
+	}
+	return status, nil
+}
+
+func (c *Cluster) logWarn(fields LogFields, args ...interface{}) {
+	if fields == nil {
+		fields = LogFields{}
+	}
+	fields["source"] = "Cluster"
+	fields["node_id"] = c.nodeId
+	LogPrint(LevelWarn, fields, args...)
+}
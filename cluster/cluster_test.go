@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	. "point-set/base"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockNode(status *NodeStatus) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/node-status", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(status)
+	})
+	mux.HandleFunc("/create-room", func(w http.ResponseWriter, r *http.Request) {
+		if !IsForwarded(r) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(status.KCPAddr))
+	})
+	mux.HandleFunc("/delete-room", func(w http.ResponseWriter, r *http.Request) {
+		if status.Rooms == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(status.KCPAddr))
+	})
+	server := httptest.NewServer(mux)
+	status.HTTPAddr = strings.TrimPrefix(server.URL, "http://")
+	return server
+}
+
+func TestClusterPlace(t *testing.T) {
+	s1 := mockNode(&NodeStatus{NodeId: 1, KCPAddr: "kcp-1", Rooms: 2, Players: 4})
+	defer s1.Close()
+	s2 := mockNode(&NodeStatus{NodeId: 2, KCPAddr: "kcp-2", Rooms: 1, Players: 4})
+	defer s2.Close()
+	dead := "127.0.0.1:1"
+	peers := []string{
+		"127.0.0.1:8080",
+		strings.TrimPrefix(s1.URL, "http://"),
+		strings.TrimPrefix(s2.URL, "http://"),
+		dead,
+	}
+
+	c := NewCluster(0, "kcp-0", "127.0.0.1:8080", NewStaticDiscovery(peers))
+	assert.Equal(t, 2, len(c.Statuses()))
+
+	local := c.Status(1, 2)
+	assert.True(t, c.IsLocal(local))
+	assert.Equal(t, local, c.Place(local))
+
+	node := c.Place(c.Status(3, 4))
+	assert.False(t, c.IsLocal(node))
+	assert.Equal(t, uint32(2), node.NodeId)
+	assert.Equal(t, "kcp-2", node.KCPAddr)
+
+	node = c.Place(c.Status(9, 9))
+	assert.Equal(t, uint32(2), node.NodeId)
+}
+
+func TestClusterForward(t *testing.T) {
+	s1 := mockNode(&NodeStatus{NodeId: 1, KCPAddr: "kcp-1", Rooms: 0})
+	defer s1.Close()
+	s2 := mockNode(&NodeStatus{NodeId: 2, KCPAddr: "kcp-2", Rooms: 1})
+	defer s2.Close()
+	peers := []string{
+		strings.TrimPrefix(s1.URL, "http://"),
+		strings.TrimPrefix(s2.URL, "http://"),
+	}
+	c := NewCluster(0, "kcp-0", "127.0.0.1:8080", NewStaticDiscovery(peers))
+
+	code, data, err := c.Forward(peers[0], "/create-room", []byte("{}"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, []byte("kcp-1"), data)
+
+	resp, err := http.Post(s1.URL+"/create-room", "application/json", strings.NewReader("{}"))
+	assert.Equal(t, nil, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	code, data, err = c.Broadcast("/delete-room", []byte("{}"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []byte("kcp-2"), data)
+
+	_, _, err = c.Forward("127.0.0.1:1", "/create-room", []byte("{}"))
+	assert.ErrorIs(t, err, ErrNodeUnreachable)
+}
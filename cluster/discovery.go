@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Discovery lists the HTTP addresses of all nodes in the cluster.
+type Discovery interface {
+	Peers() ([]string, error)
+}
+
+type StaticDiscovery struct {
+	peers []string
+}
+
+func NewStaticDiscovery(peers []string) *StaticDiscovery {
+	return &StaticDiscovery{peers: peers}
+}
+
+// ParseStaticDiscovery parses a comma separated address list, e.g. "127.0.0.1:8080,127.0.0.1:8081".
+func ParseStaticDiscovery(list string) *StaticDiscovery {
+	peers := make([]string, 0, 8)
+	for _, peer := range strings.Split(list, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return NewStaticDiscovery(peers)
+}
+
+func (d *StaticDiscovery) Peers() ([]string, error) {
+	return d.peers, nil
+}
+
+// FileDiscovery reads one address per line, blank lines and lines start with '#' are ignored.
+// The file is read on every call, so nodes can be added or removed without restart.
+type FileDiscovery struct {
+	path string
+}
+
+func NewFileDiscovery(path string) *FileDiscovery {
+	return &FileDiscovery{path: path}
+}
+
+func (d *FileDiscovery) Peers() ([]string, error) {
+	file, err := os.Open(d.path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer file.Close()
+
+	peers := make([]string, 0, 8)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			peers = append(peers, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return peers, nil
+}
@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticDiscovery(t *testing.T) {
+	peers, err := ParseStaticDiscovery("").Peers()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(peers))
+
+	peers, err = ParseStaticDiscovery(" 127.0.0.1:8080, ,127.0.0.1:8081").Peers()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"127.0.0.1:8080", "127.0.0.1:8081"}, peers)
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "peers")
+
+	_, err = NewFileDiscovery(path).Peers()
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	err = ioutil.WriteFile(path, []byte("# nodes\n127.0.0.1:8080\n\n  127.0.0.1:8081  \n"), 0644)
+	assert.Equal(t, nil, err)
+	peers, err := NewFileDiscovery(path).Peers()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"127.0.0.1:8080", "127.0.0.1:8081"}, peers)
+}
@@ -33,6 +33,30 @@ func DecodeMessage(buffer []byte) (message proto.Message, offser int, err error)
 		message = &msg.NetCommand{}
 	case msg.NetType_Hash:
 		message = &msg.NetHash{}
+	case msg.NetType_Pause:
+		message = &msg.NetPause{}
+	case msg.NetType_Resume:
+		message = &msg.NetResume{}
+	case msg.NetType_Message:
+		message = &msg.NetMessage{}
+	case msg.NetType_Ping:
+		message = &msg.NetPing{}
+	case msg.NetType_Pong:
+		message = &msg.NetPong{}
+	case msg.NetType_TimeSync:
+		message = &msg.NetTimeSync{}
+	case msg.NetType_InputDelay:
+		message = &msg.NetInputDelay{}
+	case msg.NetType_Vote:
+		message = &msg.NetVote{}
+	case msg.NetType_Ballot:
+		message = &msg.NetBallot{}
+	case msg.NetType_VoteResult:
+		message = &msg.NetVoteResult{}
+	case msg.NetType_SpeedHint:
+		message = &msg.NetSpeedHint{}
+	case msg.NetType_Progress:
+		message = &msg.NetProgress{}
 	default:
 		return nil, 0, errors.WithStack(ErrPacketBroken)
 	}
@@ -66,6 +90,30 @@ func EncodeMessage(message proto.Message, buffer []byte) ([]byte, error) {
 		buffer = append(buffer, byte(msg.NetType_Command))
 	case *msg.NetHash:
 		buffer = append(buffer, byte(msg.NetType_Hash))
+	case *msg.NetPause:
+		buffer = append(buffer, byte(msg.NetType_Pause))
+	case *msg.NetResume:
+		buffer = append(buffer, byte(msg.NetType_Resume))
+	case *msg.NetMessage:
+		buffer = append(buffer, byte(msg.NetType_Message))
+	case *msg.NetPing:
+		buffer = append(buffer, byte(msg.NetType_Ping))
+	case *msg.NetPong:
+		buffer = append(buffer, byte(msg.NetType_Pong))
+	case *msg.NetTimeSync:
+		buffer = append(buffer, byte(msg.NetType_TimeSync))
+	case *msg.NetInputDelay:
+		buffer = append(buffer, byte(msg.NetType_InputDelay))
+	case *msg.NetVote:
+		buffer = append(buffer, byte(msg.NetType_Vote))
+	case *msg.NetBallot:
+		buffer = append(buffer, byte(msg.NetType_Ballot))
+	case *msg.NetVoteResult:
+		buffer = append(buffer, byte(msg.NetType_VoteResult))
+	case *msg.NetSpeedHint:
+		buffer = append(buffer, byte(msg.NetType_SpeedHint))
+	case *msg.NetProgress:
+		buffer = append(buffer, byte(msg.NetType_Progress))
 	default:
 		return buffer, errors.WithStack(ErrMessageType)
 	}
@@ -26,6 +26,42 @@ func TestDecodeMessage(t *testing.T) {
 	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Hash), 0, 0})
 	assert.IsType(t, &msg.NetHash{}, m)
 
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Pause), 0, 0})
+	assert.IsType(t, &msg.NetPause{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Resume), 0, 0})
+	assert.IsType(t, &msg.NetResume{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Message), 0, 0})
+	assert.IsType(t, &msg.NetMessage{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Ping), 0, 0})
+	assert.IsType(t, &msg.NetPing{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Pong), 0, 0})
+	assert.IsType(t, &msg.NetPong{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_TimeSync), 0, 0})
+	assert.IsType(t, &msg.NetTimeSync{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_InputDelay), 0, 0})
+	assert.IsType(t, &msg.NetInputDelay{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Vote), 0, 0})
+	assert.IsType(t, &msg.NetVote{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Ballot), 0, 0})
+	assert.IsType(t, &msg.NetBallot{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_VoteResult), 0, 0})
+	assert.IsType(t, &msg.NetVoteResult{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_SpeedHint), 0, 0})
+	assert.IsType(t, &msg.NetSpeedHint{}, m)
+
+	m, _, _ = DecodeMessage([]byte{byte(msg.NetType_Progress), 0, 0})
+	assert.IsType(t, &msg.NetProgress{}, m)
+
 	buffer := []byte{byte(msg.NetType_Command), 0, 5}
 	buffer, _ = proto.MarshalOptions{}.MarshalAppend(buffer, &msg.NetCommand{
 		Frame: 123,
@@ -76,6 +112,42 @@ func TestEncodeMessage(t *testing.T) {
 	buffer, _ = EncodeMessage(&msg.NetHash{}, []byte{})
 	assert.Equal(t, msg.NetType_Hash, msg.NetType(buffer[0]))
 
+	buffer, _ = EncodeMessage(&msg.NetPause{}, []byte{})
+	assert.Equal(t, msg.NetType_Pause, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetResume{}, []byte{})
+	assert.Equal(t, msg.NetType_Resume, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetMessage{}, []byte{})
+	assert.Equal(t, msg.NetType_Message, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetPing{}, []byte{})
+	assert.Equal(t, msg.NetType_Ping, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetPong{}, []byte{})
+	assert.Equal(t, msg.NetType_Pong, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetTimeSync{}, []byte{})
+	assert.Equal(t, msg.NetType_TimeSync, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetInputDelay{}, []byte{})
+	assert.Equal(t, msg.NetType_InputDelay, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetVote{}, []byte{})
+	assert.Equal(t, msg.NetType_Vote, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetBallot{}, []byte{})
+	assert.Equal(t, msg.NetType_Ballot, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetVoteResult{}, []byte{})
+	assert.Equal(t, msg.NetType_VoteResult, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetSpeedHint{}, []byte{})
+	assert.Equal(t, msg.NetType_SpeedHint, msg.NetType(buffer[0]))
+
+	buffer, _ = EncodeMessage(&msg.NetProgress{}, []byte{})
+	assert.Equal(t, msg.NetType_Progress, msg.NetType(buffer[0]))
+
 	sh := &msg.NetHash{
 		Frame: 123,
 		Hash:  []byte("Mock-Hash"),
@@ -6,13 +6,19 @@ type CommandBuffer struct {
 	Buffer     []byte
 }
 
+type commandItem struct {
+	key    uint32
+	buffer *CommandBuffer
+}
+
+// CommandHeap is a min heap of commands, keyed by frame by default.
 type CommandHeap struct {
-	heap []*CommandBuffer
+	heap []commandItem
 }
 
 func NewCommandHeap(cap int) *CommandHeap {
 	return &CommandHeap{
-		heap: make([]*CommandBuffer, 0, cap),
+		heap: make([]commandItem, 0, cap),
 	}
 }
 
@@ -21,7 +27,12 @@ func (h *CommandHeap) Len() int {
 }
 
 func (h *CommandHeap) Push(p *CommandBuffer) {
-	h.heap = append(h.heap, p)
+	h.PushAt(p.Frame, p)
+}
+
+// PushAt pushes the command with a custom key, e.g. the frame to release it.
+func (h *CommandHeap) PushAt(key uint32, p *CommandBuffer) {
+	h.heap = append(h.heap, commandItem{key, p})
 	h.up(h.Len() - 1)
 }
 
@@ -29,7 +40,14 @@ func (h *CommandHeap) Peek() *CommandBuffer {
 	if h.Len() <= 0 {
 		return nil
 	}
-	return h.heap[0]
+	return h.heap[0].buffer
+}
+
+func (h *CommandHeap) PeekKey() uint32 {
+	if h.Len() <= 0 {
+		return 0
+	}
+	return h.heap[0].key
 }
 
 func (h *CommandHeap) Pop() *CommandBuffer {
@@ -41,8 +59,8 @@ func (h *CommandHeap) Pop() *CommandBuffer {
 	h.heap[0], h.heap[n] = h.heap[n], h.heap[0]
 	h.down(0, n)
 
-	p := h.heap[n]
-	h.heap[n] = nil
+	p := h.heap[n].buffer
+	h.heap[n] = commandItem{}
 	h.heap = h.heap[0:n]
 	return p
 }
@@ -50,7 +68,7 @@ func (h *CommandHeap) Pop() *CommandBuffer {
 func (h *CommandHeap) up(j int) {
 	for {
 		i := (j - 1) / 2 // parent
-		if i == j || h.heap[j].Frame >= h.heap[i].Frame {
+		if i == j || h.heap[j].key >= h.heap[i].key {
 			break
 		}
 		h.heap[i], h.heap[j] = h.heap[j], h.heap[i]
@@ -66,10 +84,10 @@ func (h *CommandHeap) down(i0, n int) bool {
 			break
 		}
 		j := j1 // left child
-		if j2 := j1 + 1; j2 < n && h.heap[j2].Frame < h.heap[j1].Frame {
+		if j2 := j1 + 1; j2 < n && h.heap[j2].key < h.heap[j1].key {
 			j = j2 // = 2*i + 2  // right child
 		}
-		if h.heap[j].Frame >= h.heap[i].Frame {
+		if h.heap[j].key >= h.heap[i].key {
 			break
 		}
 		h.heap[i], h.heap[j] = h.heap[j], h.heap[i]
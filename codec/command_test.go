@@ -32,4 +32,12 @@ func TestCommandHeap(t *testing.T) {
 	assert.Equal(t, c3, heap.Pop())
 	assert.Equal(t, c1, heap.Pop())
 	assert.Equal(t, 0, heap.Len())
+
+	heap.PushAt(20, c2)
+	heap.PushAt(12, c1)
+	assert.Equal(t, uint32(12), heap.PeekKey())
+	assert.Equal(t, c1, heap.Pop())
+	assert.Equal(t, uint32(20), heap.PeekKey())
+	assert.Equal(t, c2, heap.Pop())
+	assert.Equal(t, uint32(0), heap.PeekKey())
 }
@@ -0,0 +1,98 @@
+package core
+
+import (
+	. "point-set/base"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// conv layout: | node id (8 bits) | sequence (24 bits) |
+const (
+	ConvNodeBits = 8
+	ConvSeqBits  = 32 - ConvNodeBits
+	MaxNodeId    = 1<<ConvNodeBits - 1
+)
+
+type ConvAllocator struct {
+	nodeId  uint32
+	seqBits uint32
+
+	// multi-thread fields
+	_mutex sync.Mutex
+	_next  uint32
+	_used  map[uint32]bool
+}
+
+func NewConvAllocator(nodeId uint32) (*ConvAllocator, error) {
+	return newConvAllocator(nodeId, ConvSeqBits)
+}
+
+func newConvAllocator(nodeId uint32, seqBits uint32) (*ConvAllocator, error) {
+	if nodeId > MaxNodeId {
+		return nil, errors.WithStack(ErrArguments)
+	}
+	mask := uint32(1)<<seqBits - 1
+	return &ConvAllocator{
+		nodeId:  nodeId,
+		seqBits: seqBits,
+
+		_mutex: sync.Mutex{},
+		// start from a time based sequence, reduces conv reuse across restarts
+		_next: uint32(time.Now().UnixNano()/int64(time.Millisecond)) & mask,
+		_used: make(map[uint32]bool, 1024),
+	}, nil
+}
+
+func (a *ConvAllocator) NodeId() uint32 {
+	return a.nodeId
+}
+
+// Alloc returns a conv not used by any live room, sequence 0 is never allocated.
+func (a *ConvAllocator) Alloc() (uint32, error) {
+	a._mutex.Lock()
+	defer a._mutex.Unlock()
+
+	mask := uint32(1)<<a.seqBits - 1
+	for i := uint32(0); i <= mask; i++ {
+		seq := a._next
+		a._next = (a._next + 1) & mask
+		if seq == 0 {
+			continue
+		}
+		conv := a.nodeId<<a.seqBits | seq
+		if !a._used[conv] {
+			a._used[conv] = true
+			return conv, nil
+		}
+	}
+	return 0, errors.WithStack(ErrConvExhausted)
+}
+
+// Reserve marks a fixed conv as used, e.g. the convs of test room.
+func (a *ConvAllocator) Reserve(conv uint32) error {
+	a._mutex.Lock()
+	defer a._mutex.Unlock()
+
+	if a._used[conv] {
+		return errors.WithStack(ErrConvExisted)
+	}
+	a._used[conv] = true
+	return nil
+}
+
+// Release recycles the conv, call it only after the conv is unreachable from RoomManager.
+func (a *ConvAllocator) Release(conv uint32) {
+	a._mutex.Lock()
+	defer a._mutex.Unlock()
+
+	delete(a._used, conv)
+}
+
+func (a *ConvAllocator) Len() int {
+	a._mutex.Lock()
+	defer a._mutex.Unlock()
+
+	return len(a._used)
+}
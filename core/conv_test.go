@@ -0,0 +1,52 @@
+package core
+
+import (
+	. "point-set/base"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConvAllocator(t *testing.T) {
+	_, err := NewConvAllocator(MaxNodeId + 1)
+	assert.ErrorIs(t, err, ErrArguments)
+
+	alloc, err := NewConvAllocator(MaxNodeId)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(MaxNodeId), alloc.NodeId())
+}
+
+func TestConvAllocatorAlloc(t *testing.T) {
+	alloc, _ := newConvAllocator(5, 4)
+	convs := map[uint32]bool{}
+	for i := 0; i < 15; i++ {
+		conv, err := alloc.Alloc()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, uint32(5), conv>>4)
+		assert.NotEqual(t, uint32(0), conv&0xF)
+		assert.False(t, convs[conv])
+		convs[conv] = true
+	}
+	assert.Equal(t, 15, alloc.Len())
+
+	_, err := alloc.Alloc()
+	assert.ErrorIs(t, err, ErrConvExhausted)
+
+	alloc.Release(5<<4 | 9)
+	conv, err := alloc.Alloc()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(5<<4|9), conv)
+}
+
+func TestConvAllocatorReserve(t *testing.T) {
+	alloc, _ := newConvAllocator(0, 2)
+	assert.Equal(t, nil, alloc.Reserve(1))
+	assert.Equal(t, nil, alloc.Reserve(3))
+	assert.ErrorIs(t, alloc.Reserve(3), ErrConvExisted)
+
+	conv, err := alloc.Alloc()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(2), conv)
+	_, err = alloc.Alloc()
+	assert.ErrorIs(t, err, ErrConvExhausted)
+}
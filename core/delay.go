@@ -0,0 +1,34 @@
+package core
+
+import (
+	. "point-set/base"
+	"time"
+)
+
+// recommendDelay converts the latency of input to a delay in frames.
+func recommendDelay(latency time.Duration) uint32 {
+	if latency < 0 {
+		latency = 0
+	}
+	frame := time.Second / FPS
+	delay := uint32((latency + frame - 1) / frame)
+	if delay < MinInputDelay {
+		delay = MinInputDelay
+	}
+	if delay > MaxInputDelay {
+		delay = MaxInputDelay
+	}
+	return delay
+}
+
+// applyHysteresis raises the delay at once to avoid stalls, but lowers it
+// only if the required delay drops by 2 frames, and keeps 1 frame margin.
+func applyHysteresis(current uint32, required uint32) uint32 {
+	if required > current {
+		return required
+	}
+	if required+1 < current {
+		return required + 1
+	}
+	return current
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	. "point-set/base"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendDelay(t *testing.T) {
+	frame := time.Second / FPS
+	assert.Equal(t, uint32(MinInputDelay), recommendDelay(0))
+	assert.Equal(t, uint32(MinInputDelay), recommendDelay(-time.Second))
+	assert.Equal(t, uint32(2), recommendDelay(frame+time.Millisecond))
+	assert.Equal(t, uint32(3), recommendDelay(frame*3))
+	assert.Equal(t, uint32(MaxInputDelay), recommendDelay(time.Minute))
+}
+
+func TestApplyHysteresis(t *testing.T) {
+	assert.Equal(t, uint32(5), applyHysteresis(3, 5))
+	assert.Equal(t, uint32(5), applyHysteresis(5, 4))
+	assert.Equal(t, uint32(4), applyHysteresis(5, 3))
+	assert.Equal(t, uint32(4), applyHysteresis(4, 3))
+	assert.Equal(t, uint32(2), applyHysteresis(4, 1))
+}
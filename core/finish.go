@@ -0,0 +1,92 @@
+package core
+
+import (
+	"fmt"
+	. "point-set/base"
+	msg "point-set/message"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// finishError carries the diagnostics of a finish sent to the client, it wraps a base error.
+type finishError struct {
+	err      error
+	code     msg.NetFinishCode
+	detail   string
+	expected uint32        // with sync codes
+	received uint32        // with sync codes
+	skew     time.Duration // with sync codes, client time minus server time
+}
+
+func (e *finishError) Error() string {
+	return e.detail + ": " + e.err.Error()
+}
+
+func (e *finishError) Unwrap() error {
+	return e.err
+}
+
+func newFinishError(err error, code msg.NetFinishCode, format string, args ...interface{}) error {
+	return errors.WithStack(&finishError{
+		err:    err,
+		code:   code,
+		detail: fmt.Sprintf(format, args...),
+	})
+}
+
+// syncError reports the frame due by the room clock and the skew of a received frame.
+func (p *Player) syncError(err error, code msg.NetFinishCode, received uint32, format string, args ...interface{}) error {
+	startedAt := p.room.StartedAt()
+	now := p.room.Now()
+	expected := uint32(0)
+	if elapsed := now.Sub(startedAt); elapsed > 0 {
+		expected = uint32(elapsed * FPS / time.Second)
+	}
+	remote := startedAt.Add(time.Second / FPS * time.Duration(received))
+	return errors.WithStack(&finishError{
+		err:      err,
+		code:     code,
+		detail:   fmt.Sprintf(format, args...),
+		expected: expected,
+		received: received,
+		skew:     remote.Sub(now),
+	})
+}
+
+// diagnose finds the diagnostics of an error, errors without them get a code by their kind.
+func diagnose(err error) *finishError {
+	var fe *finishError
+	if errors.As(err, &fe) {
+		return fe
+	}
+
+	fe = &finishError{err: err, detail: errors.Cause(err).Error()}
+	if errors.Is(err, ErrNetworkBroken) {
+		fe.code = msg.NetFinishCode_CodeNetworkError
+	} else if errors.Is(err, ErrPacketBroken) || errors.Is(err, ErrPacketSize) {
+		fe.code = msg.NetFinishCode_CodeBrokenPacket
+	} else if errors.Is(err, ErrInvalidCommand) {
+		fe.code = msg.NetFinishCode_CodeInvalidCommand
+	} else if errors.Is(err, ErrAuthFailed) {
+		fe.code = msg.NetFinishCode_CodeAuthFailed
+	} else if errors.Is(err, ErrDataOutOfSync) {
+		fe.code = msg.NetFinishCode_CodeHashMismatch
+	} else if errors.Is(err, ErrSurrender) {
+		fe.detail = "" // voluntary
+	} else if !errors.Is(err, ErrTimeOutOfSync) && !errors.Is(err, ErrInputFlood) {
+		fe.detail = "" // don't leak server errors
+	}
+	return fe
+}
+
+func (fe *finishError) apply(finish *msg.NetFinish) {
+	finish.Code = fe.code
+	finish.Detail = fe.detail
+	if len(finish.Detail) > MaxDetailSize {
+		finish.Detail = finish.Detail[:MaxDetailSize]
+	}
+	finish.ExpectedFrame = fe.expected
+	finish.ReceivedFrame = fe.received
+	finish.Skew = fe.skew.Milliseconds()
+}
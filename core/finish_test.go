@@ -0,0 +1,64 @@
+package core
+
+import (
+	. "point-set/base"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinishDiagnose(t *testing.T) {
+	finish := &msg.NetFinish{}
+	diagnose(errors.WithStack(ErrAuthFailed)).apply(finish)
+	assert.Equal(t, msg.NetFinishCode_CodeAuthFailed, finish.Code)
+	assert.Equal(t, ErrAuthFailed.Error(), finish.Detail)
+
+	finish = &msg.NetFinish{}
+	diagnose(errors.New("secret")).apply(finish)
+	assert.Equal(t, msg.NetFinishCode_CodeNone, finish.Code)
+	assert.Equal(t, "", finish.Detail)
+
+	err := newFinishError(ErrInputFlood, msg.NetFinishCode_CodeFloodPayload, "payload size(%d)", 999)
+	assert.ErrorIs(t, err, ErrInputFlood)
+	finish = &msg.NetFinish{}
+	diagnose(err).apply(finish)
+	assert.Equal(t, msg.NetFinishCode_CodeFloodPayload, finish.Code)
+	assert.Equal(t, "payload size(999)", finish.Detail)
+
+	err = newFinishError(ErrInputFlood, msg.NetFinishCode_CodeFloodPayload, "%s", make([]byte, MaxDetailSize*2))
+	finish = &msg.NetFinish{}
+	diagnose(err).apply(finish)
+	assert.Equal(t, MaxDetailSize, len(finish.Detail))
+}
+
+func TestFinishSync(t *testing.T) {
+	_, room, player, _ := prepare()
+	room._startedAt = time.Now().Add(-time.Second * 10).UnixMilli()
+
+	player.frame = 200 // 20s
+	_, err := player.nextDealine()
+	assert.ErrorIs(t, err, ErrTimeOutOfSync)
+	finish := &msg.NetFinish{}
+	diagnose(err).apply(finish)
+	assert.Equal(t, msg.NetFinishCode_CodeTimeAhead, finish.Code)
+	assert.Equal(t, uint32(200), finish.ReceivedFrame)
+	assert.InDelta(t, 100, finish.ExpectedFrame, 1)
+	assert.InDelta(t, 10000, finish.Skew, 100)
+
+	player.frame = 10 // 1s
+	_, err = player.nextDealine()
+	finish = &msg.NetFinish{}
+	diagnose(err).apply(finish)
+	assert.Equal(t, msg.NetFinishCode_CodeTimeBehind, finish.Code)
+	assert.InDelta(t, -9000, finish.Skew, 100)
+
+	err = player.onKCPCommand(&msg.NetCommand{Frame: 20}, 0, []byte{})
+	finish = &msg.NetFinish{}
+	diagnose(err).apply(finish)
+	assert.Equal(t, msg.NetFinishCode_CodeFrameSkipped, finish.Code)
+	assert.Equal(t, uint32(20), finish.ReceivedFrame)
+	assert.Equal(t, "frame(20) after frame(10)", finish.Detail)
+}
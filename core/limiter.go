@@ -0,0 +1,42 @@
+package core
+
+import (
+	. "point-set/base"
+	"time"
+)
+
+// rateLimiter is a token bucket, rate <= 0 means unlimited.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   TimeZero,
+	}
+}
+
+func (l *rateLimiter) Allow(n int, now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens < float64(n) {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
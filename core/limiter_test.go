@@ -0,0 +1,25 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(100, 200)
+	assert.True(t, limiter.Allow(150, now))
+	assert.False(t, limiter.Allow(100, now))
+	assert.True(t, limiter.Allow(50, now))
+
+	assert.False(t, limiter.Allow(60, now.Add(time.Millisecond*500)))
+	assert.True(t, limiter.Allow(50, now.Add(time.Millisecond*500)))
+
+	assert.True(t, limiter.Allow(200, now.Add(time.Second*10)))
+	assert.False(t, limiter.Allow(1, now.Add(time.Second*10)))
+
+	unlimited := newRateLimiter(0, 0)
+	assert.True(t, unlimited.Allow(1<<30, now))
+}
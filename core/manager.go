@@ -1,10 +1,12 @@
 package core
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	. "point-set/base"
+	msg "point-set/message"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	gonanoid "github.com/matoous/go-nanoid"
@@ -12,10 +14,35 @@ import (
 	"github.com/xtaci/kcp-go/v5"
 )
 
+// Recorder persists the summaries of finished rooms.
+type Recorder interface {
+	Record(summary *RoomSummary) error
+}
+
+// Options configures a RoomManager embedded in other programs, zero values use the defaults.
+type Options struct {
+	Addr          string         // KCP listen address, ignored if Listener is set
+	NodeId        uint32         // node id in [0, 255], unique in the cluster
+	Listener      *kcp.Listener  // listen by the caller, e.g. on a shared connection
+	Block         kcp.BlockCrypt // packet encryption, nil for none
+	DataShards    int            // FEC data shards, 0 to disable FEC
+	ParityShards  int            // FEC parity shards
+	ListenTimeout time.Duration  // interval of cleaning finished rooms, default ListenTimeout
+	Logger        Logger         // process wide logger, nil keeps the current one
+	Observer      Observer       // lifecycle events of all rooms, nil for none
+	Recorder      Recorder       // persists finished rooms, nil for none
+	RulesLoader   RulesLoader    // loads RoomOptions.Rules, nil to disable
+}
+
 type RoomManager struct {
-	listener  *kcp.Listener
-	chFinish  chan string
-	finishSet []string
+	listener      *kcp.Listener
+	allocator     *ConvAllocator
+	listenTimeout time.Duration
+	observer      Observer
+	recorder      Recorder
+	loader        RulesLoader
+	chFinish      chan string
+	finishSet     []string
 
 	// multi-thread fields
 	_mutex sync.Mutex
@@ -23,16 +50,44 @@ type RoomManager struct {
 	_convs map[uint32]*Room
 }
 
-func NewRoomManager(addr string) (*RoomManager, error) {
-	listener, err := kcp.ListenWithOptions(addr, nil, 0, 0)
+func NewRoomManager(addr string, nodeId uint32) (*RoomManager, error) {
+	return NewRoomManagerWithOptions(Options{Addr: addr, NodeId: nodeId})
+}
+
+func NewRoomManagerWithOptions(options Options) (*RoomManager, error) {
+	if options.DataShards < 0 || options.ParityShards < 0 || options.ListenTimeout < 0 {
+		return nil, errors.WithStack(ErrArguments)
+	}
+	allocator, err := NewConvAllocator(options.NodeId)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
+	}
+	listener := options.Listener
+	if listener == nil {
+		listener, err = kcp.ListenWithOptions(options.Addr, options.Block, options.DataShards, options.ParityShards)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if options.ListenTimeout == 0 {
+		options.ListenTimeout = ListenTimeout
+	}
+	if options.Observer == nil {
+		options.Observer = NopObserver{}
+	}
+	if options.Logger != nil {
+		SetLogger(options.Logger)
 	}
 
 	return &RoomManager{
-		listener:  listener,
-		chFinish:  make(chan string, 1024),
-		finishSet: make([]string, 0, 128),
+		listener:      listener,
+		allocator:     allocator,
+		listenTimeout: options.ListenTimeout,
+		observer:      options.Observer,
+		recorder:      options.Recorder,
+		loader:        options.RulesLoader,
+		chFinish:      make(chan string, 1024),
+		finishSet:     make([]string, 0, 128),
 
 		_mutex: sync.Mutex{},
 		_rooms: make(map[string]*Room, 256),
@@ -44,36 +99,112 @@ func (m *RoomManager) CreateRoom(
 	roomId string,
 	duration time.Duration,
 	players []PlayerBasic,
+	options RoomOptions,
 ) ([]*PlayerConfig, error) {
+	if err := options.validate(players); err != nil {
+		return nil, err
+	}
+	validator, err := GetValidator(options.Mode)
+	factory := GetSimulator(options.Mode)
+	if err != nil && !(errors.Is(err, ErrModeNotFound) && (factory != nil || options.Rules != "")) {
+		return nil, err
+	}
+	if options.Rules != "" && m.loader == nil {
+		return nil, errors.Wrapf(ErrModeNotFound, "rules(%s)", options.Rules)
+	}
+	options.Validator = validator
+	if options.Observer == nil {
+		options.Observer = m.observer
+	}
+	if options.Seed == 0 {
+		options.Seed = genSeed()
+	}
+
+	m._mutex.Lock()
+	defer m._mutex.Unlock()
+
+	if _, ok := m._rooms[roomId]; ok {
+		return nil, errors.WithStack(ErrRoomExisted)
+	}
+
 	cfgsMap := make(map[uint32]*PlayerConfig, len(players))
 	cfgsList := make([]*PlayerConfig, 0, len(players))
+	release := func() {
+		for conv := range cfgsMap {
+			m.allocator.Release(conv)
+		}
+	}
 	for _, player := range players {
+		conv, err := m.allocator.Alloc()
+		if err != nil {
+			release()
+			return nil, err
+		}
 		cfg := &PlayerConfig{
 			PlayerId: player.PlayerId,
 			Team:     player.Team,
 			Password: genPassword(),
-			Conv:     genConv(),
+			Conv:     conv,
+			Metadata: player.Metadata,
 		}
 		cfgsMap[cfg.Conv] = cfg
 		cfgsList = append(cfgsList, cfg)
 	}
 
-	m._mutex.Lock()
-	defer m._mutex.Unlock()
-
-	room := NewRoom(roomId, duration, cfgsMap, m.chFinish)
-	if _, ok := m._rooms[roomId]; ok {
-		return nil, errors.WithStack(ErrRoomExisted)
+	start := &msg.NetStart{
+		Players:  newRoster(cfgsMap),
+		Seed:     options.Seed,
+		Settings: options.Settings,
 	}
+	if options.Rules != "" {
+		rules, err := m.loader.Load(options.Rules, start)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		options.Validator = rules
+		options.Simulator = rules
+	} else if factory != nil {
+		simulator, err := factory(start)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		options.Simulator = simulator
+	}
+
+	room := NewRoom(roomId, duration, cfgsMap, options, m.chFinish)
 	m._rooms[roomId] = room
 
 	for _, config := range cfgsMap {
 		m._convs[config.Conv] = room
 	}
+	room.observer.RoomCreated(roomId)
 
 	return cfgsList, nil
 }
 
+// SetRecorder sets the recorder of finished rooms, call it before Listen.
+func (m *RoomManager) SetRecorder(recorder Recorder) {
+	m.recorder = recorder
+}
+
+// SetRulesLoader sets the loader of room rules, call it before creating rooms.
+func (m *RoomManager) SetRulesLoader(loader RulesLoader) {
+	m.loader = loader
+}
+
+func (m *RoomManager) GetRoom(roomId string) (*Room, error) {
+	m._mutex.Lock()
+	defer m._mutex.Unlock()
+
+	room, ok := m._rooms[roomId]
+	if !ok {
+		return nil, errors.WithStack(ErrRoomNotFound)
+	}
+	return room, nil
+}
+
 func (m *RoomManager) DeleteRoom(roomId string) error {
 	m._mutex.Lock()
 	room, ok := m._rooms[roomId]
@@ -87,9 +218,19 @@ func (m *RoomManager) DeleteRoom(roomId string) error {
 	return nil
 }
 
+func (m *RoomManager) Load() (rooms int, players int) {
+	m._mutex.Lock()
+	defer m._mutex.Unlock()
+
+	for _, room := range m._rooms {
+		players += room.MaxPlayers()
+	}
+	return len(m._rooms), players
+}
+
 func (m *RoomManager) Listen() error {
 	for {
-		m.listener.SetReadDeadline(time.Now().Add(ListenTimeout))
+		m.listener.SetReadDeadline(time.Now().Add(m.listenTimeout))
 		session, err := m.listener.AcceptKCP()
 		if err != nil {
 			if errors.Is(err, kcp.ErrTimeout) {
@@ -129,15 +270,29 @@ func (m *RoomManager) handleTimeout() {
 		m.finishSet = append(m.finishSet, <-m.chFinish)
 	}
 
+	var finished []*Room
 	m._mutex.Lock()
-	defer m._mutex.Unlock()
-
 	for _, roomId := range m.finishSet {
+		if room, ok := m._rooms[roomId]; ok {
+			finished = append(finished, room)
+		}
 		delete(m._rooms, roomId)
 	}
 	for conv, room := range m._convs {
-		if now.Sub(room.CreatedAt()) > ConnectTimeout {
+		if now.Sub(room.CreatedAt()) > room.Timeouts().Connect {
 			delete(m._convs, conv)
+			m.allocator.Release(conv)
+		}
+	}
+	m._mutex.Unlock()
+
+	for _, room := range finished {
+		summary := room.Summary()
+		room.observer.RoomFinished(summary)
+		if m.recorder != nil {
+			if err := m.recorder.Record(summary); err != nil {
+				m.logWarn(LogFields{"room_id": room.RoomId()}, err)
+			}
 		}
 	}
 }
@@ -162,10 +317,15 @@ func (m *RoomManager) CreateTestRoom() {
 	defer m._mutex.Unlock()
 
 	roomId := "r1"
-	room := NewRoom(roomId, time.Minute*40, cfgsMap, m.chFinish)
+	room := NewRoom(roomId, time.Minute*40, cfgsMap, RoomOptions{}, m.chFinish)
 	if _, ok := m._rooms[roomId]; ok {
 		panic(ErrRoomExisted)
 	}
+	for conv := range cfgsMap {
+		if err := m.allocator.Reserve(conv); err != nil {
+			panic(err)
+		}
+	}
 	m._rooms[roomId] = room
 
 	for _, config := range cfgsMap {
@@ -189,10 +349,11 @@ func genPassword() string {
 	return password
 }
 
-var counter uint32
-
-func genConv() uint32 {
-	t := uint32(time.Now().Second())
-	n := atomic.AddUint32(&counter, 7)
-	return (n&0x7FFF)<<17 | t&0x1FFFF
+func genSeed() uint64 {
+	var buf [8]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint64(buf[:])
 }
@@ -1,12 +1,115 @@
 package core
 
 import (
+	. "point-set/base"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewRoomManager(t *testing.T) {
-	_, err := NewRoomManager("127.0.0.1:12345")
+	_, err := NewRoomManager("127.0.0.1:12345", 0)
 	assert.Equal(t, nil, err)
 }
+
+func TestRoomManagerLoad(t *testing.T) {
+	mgr, err := NewRoomManager("127.0.0.1:12346", 0)
+	assert.Equal(t, nil, err)
+
+	rooms, players := mgr.Load()
+	assert.Equal(t, 0, rooms)
+	assert.Equal(t, 0, players)
+
+	_, err = mgr.CreateRoom("room-1", time.Minute, []PlayerBasic{{PlayerId: "p1"}, {PlayerId: "p2"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	_, err = mgr.CreateRoom("room-2", time.Minute, []PlayerBasic{{PlayerId: "p3"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	rooms, players = mgr.Load()
+	assert.Equal(t, 2, rooms)
+	assert.Equal(t, 3, players)
+}
+
+func TestRoomManagerConvs(t *testing.T) {
+	mgr, err := NewRoomManager("127.0.0.1:12347", 3)
+	assert.Equal(t, nil, err)
+
+	cfgs1, err := mgr.CreateRoom("room-1", time.Minute, []PlayerBasic{{PlayerId: "p1"}, {PlayerId: "p2"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	cfgs2, err := mgr.CreateRoom("room-2", time.Minute, []PlayerBasic{{PlayerId: "p3"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	_, err = mgr.CreateRoom("room-2", time.Minute, []PlayerBasic{{PlayerId: "p4"}}, RoomOptions{})
+	assert.ErrorIs(t, err, ErrRoomExisted)
+	assert.Equal(t, 3, mgr.allocator.Len())
+	assert.NotEqual(t, cfgs1[0].Conv, cfgs1[1].Conv)
+	assert.NotEqual(t, cfgs1[1].Conv, cfgs2[0].Conv)
+	assert.Equal(t, uint32(3), cfgs2[0].Conv>>ConvSeqBits)
+
+	mgr._rooms["room-1"].createdAt = time.Now().Add(-ConnectTimeout * 2)
+	mgr.handleTimeout()
+	assert.Equal(t, 1, len(mgr._convs))
+	assert.Equal(t, 1, mgr.allocator.Len())
+}
+
+func TestRoomManagerSeed(t *testing.T) {
+	mgr, err := NewRoomManager("127.0.0.1:12348", 0)
+	assert.Equal(t, nil, err)
+
+	_, err = mgr.CreateRoom("room-1", time.Minute, []PlayerBasic{{PlayerId: "p1"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	_, err = mgr.CreateRoom("room-2", time.Minute, []PlayerBasic{{PlayerId: "p2"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, uint64(0), mgr._rooms["room-1"].options.Seed)
+	assert.NotEqual(t, mgr._rooms["room-1"].options.Seed, mgr._rooms["room-2"].options.Seed)
+
+	settings := []byte("map=forest")
+	_, err = mgr.CreateRoom("room-3", time.Minute, []PlayerBasic{{PlayerId: "p3"}}, RoomOptions{Seed: 42, Settings: settings})
+	assert.Equal(t, nil, err)
+	start := mgr._rooms["room-3"].netStart()
+	assert.Equal(t, uint64(42), start.Seed)
+	assert.Equal(t, settings, start.Settings)
+
+	_, err = mgr.CreateRoom("room-4", time.Minute, []PlayerBasic{{PlayerId: "p4"}}, RoomOptions{Settings: make([]byte, MaxPacketSize)})
+	assert.ErrorIs(t, err, ErrArguments)
+}
+
+type recordObserver struct {
+	NopObserver
+	created  []string
+	finished []string
+}
+
+func (o *recordObserver) RoomCreated(roomId string) {
+	o.created = append(o.created, roomId)
+}
+
+func (o *recordObserver) RoomFinished(summary *RoomSummary) {
+	o.finished = append(o.finished, summary.RoomId)
+}
+
+func TestRoomManagerOptions(t *testing.T) {
+	_, err := NewRoomManagerWithOptions(Options{Addr: "127.0.0.1:12350", DataShards: -1})
+	assert.ErrorIs(t, err, ErrArguments)
+	_, err = NewRoomManagerWithOptions(Options{Addr: "127.0.0.1:12350", NodeId: 256})
+	assert.Error(t, err)
+
+	observer := &recordObserver{}
+	mgr, err := NewRoomManagerWithOptions(Options{
+		Addr:          "127.0.0.1:12350",
+		ListenTimeout: time.Millisecond * 100,
+		Observer:      observer,
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Millisecond*100, mgr.listenTimeout)
+
+	_, err = mgr.CreateRoom("room-1", time.Minute, []PlayerBasic{{PlayerId: "p1"}}, RoomOptions{})
+	assert.Equal(t, nil, err)
+	_, err = mgr.CreateRoom("room-2", time.Minute, []PlayerBasic{{PlayerId: "p2"}}, RoomOptions{Observer: NopObserver{}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"room-1"}, observer.created)
+
+	mgr.chFinish <- "room-1"
+	mgr.chFinish <- "room-2"
+	mgr.handleTimeout()
+	assert.Equal(t, []string{"room-1"}, observer.finished)
+}
@@ -0,0 +1,24 @@
+package core
+
+import msg "point-set/message"
+
+// Observer receives the lifecycle events of rooms and players.
+// Callbacks are called from the goroutines of rooms and players, they must not block.
+type Observer interface {
+	RoomCreated(roomId string)
+	RoomStarted(roomId string)
+	RoomFinished(summary *RoomSummary)
+	PlayerConnected(roomId string, conv uint32, playerId string)
+	PlayerFinished(roomId string, conv uint32, playerId string, cause msg.NetFinishCause)
+	HashMismatch(roomId string, conv uint32, frame uint32)
+}
+
+// NopObserver ignores all events, embed it to implement part of Observer.
+type NopObserver struct{}
+
+func (NopObserver) RoomCreated(string)                                        {}
+func (NopObserver) RoomStarted(string)                                        {}
+func (NopObserver) RoomFinished(*RoomSummary)                                 {}
+func (NopObserver) PlayerConnected(string, uint32, string)                    {}
+func (NopObserver) PlayerFinished(string, uint32, string, msg.NetFinishCause) {}
+func (NopObserver) HashMismatch(string, uint32, uint32)                       {}
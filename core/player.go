@@ -24,9 +24,12 @@ const (
 
 const sendBufSize = 16
 
+const pingHistory = 4 // recent pings awaiting pongs
+
 type PlayerBasic struct {
 	PlayerId string `json:"player_id"`
 	Team     uint8  `json:"team"`
+	Metadata []byte `json:"metadata,omitempty"`
 }
 
 type PlayerConfig struct {
@@ -34,6 +37,7 @@ type PlayerConfig struct {
 	Team     uint8  `json:"team"`
 	Password string `json:"password"`
 	Conv     uint32 `json:"conv"`
+	Metadata []byte `json:"metadata,omitempty"`
 }
 
 type Player struct {
@@ -43,15 +47,47 @@ type Player struct {
 	session ISession
 
 	// mutable fields
-	channel  chan interface{}
-	sendBuf  []byte
-	recvBuf  []byte
-	state    msg.NetPlayerState
-	frame    uint32
-	deadline time.Time
-	cmdHeap  *CommandHeap
-	cmdBufs  [][]byte
-	players  []*Player
+	channel   chan interface{}
+	sendBuf   []byte
+	recvBuf   []byte
+	state     msg.NetPlayerState
+	frame     uint32
+	deadline  time.Time
+	cmdHeap   *CommandHeap
+	cmdBufs   [][]byte
+	players   []*Player
+	limiter   *rateLimiter
+	packets   int
+	msgLimit  *rateLimiter
+	pingAt    time.Time
+	pingSeq   uint32
+	pongSeq   uint32
+	pingSent  [pingHistory]time.Time // sending time of recent pings by seq
+	cause     msg.NetFinishCause
+	commandAt time.Time // receiving time of the last command
+	drifts    driftTracker
+
+	// multi-thread fields
+	_rtt    int64
+	_jitter int64
+	_lag    int64
+	_lagDev int64
+
+	_queued   int64 // bytes of queued messages and held commands
+	_overflow int32 // 1 if a message is dropped, see deliver
+}
+
+type PlayerStats struct {
+	Conv     uint32 `json:"conv"`
+	PlayerId string `json:"player_id"`
+	Team     uint8  `json:"team"`
+	State    string `json:"state"`
+	Frame    uint32 `json:"frame"`
+	RTT      int64  `json:"rtt"`    // ms
+	Jitter   int64  `json:"jitter"` // ms
+	Lag      int64  `json:"lag"`    // ms
+
+	Lags LagDistribution `json:"lags"` // filled by Room.Stats
 }
 
 func NewPlayer(
@@ -68,15 +104,33 @@ func NewPlayer(
 		config:  config,
 		session: session,
 
-		channel:  make(chan interface{}, KCPWindowSize),
-		sendBuf:  make([]byte, 0, MaxPacketSize),
-		recvBuf:  make([]byte, MaxPacketSize+1),
-		state:    msg.NetPlayerState_Initing,
-		frame:    0,
-		deadline: TimeZero,
-		cmdHeap:  NewCommandHeap(KCPWindowSize),
-		cmdBufs:  make([][]byte, 0, sendBufSize),
-		players:  make([]*Player, 0, room.MaxPlayers()),
+		channel:   make(chan interface{}, ChannelSize),
+		sendBuf:   make([]byte, 0, MaxPacketSize),
+		recvBuf:   make([]byte, MaxPacketSize+1),
+		state:     msg.NetPlayerState_Initing,
+		frame:     0,
+		deadline:  TimeZero,
+		cmdHeap:   NewCommandHeap(KCPWindowSize),
+		cmdBufs:   make([][]byte, 0, sendBufSize),
+		players:   make([]*Player, 0, room.MaxPlayers()),
+		limiter:   newRateLimiter(Limits.BytesPerSecond, Limits.BytesPerSecond),
+		packets:   0,
+		msgLimit:  newRateLimiter(Limits.MessagesPerSecond, Limits.MessagesPerSecond*2),
+		pingAt:    TimeZero,
+		pingSeq:   0,
+		pongSeq:   0,
+		pingSent:  [pingHistory]time.Time{},
+		cause:     msg.NetFinishCause_GameOver,
+		commandAt: TimeZero,
+		drifts:    driftTracker{},
+
+		_rtt:    0,
+		_jitter: 0,
+		_lag:    0,
+		_lagDev: 0,
+
+		_queued:   0,
+		_overflow: 0,
 	}
 
 	return player, nil
@@ -94,31 +148,90 @@ func (p *Player) Conv() uint32 {
 	return p.config.Conv
 }
 
+func (p *Player) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p._rtt))
+}
+
+func (p *Player) Jitter() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p._jitter))
+}
+
+// Lag is the smoothed arrival time of commands behind the room clock.
+func (p *Player) Lag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p._lag))
+}
+
+// InputLatency estimates the time for an input to reach other players.
+func (p *Player) InputLatency() time.Duration {
+	latency := p.Lag() + time.Duration(atomic.LoadInt64(&p._lagDev))*2
+	if latency < 0 {
+		latency = 0
+	}
+	return latency + p.RTT()/2
+}
+
+func (p *Player) Stats() PlayerStats {
+	return PlayerStats{
+		Conv:     p.Conv(),
+		PlayerId: p.PlayerId(),
+		Team:     p.config.Team,
+		State:    p.loadState().String(),
+		Frame:    atomic.LoadUint32(&p.frame),
+		RTT:      p.RTT().Milliseconds(),
+		Jitter:   p.Jitter().Milliseconds(),
+		Lag:      p.Lag().Milliseconds(),
+	}
+}
+
 func (p *Player) Close() {
-	p.channel <- msg.NetFinish{
-		Frame: p.frame,
+	p.deliver(&msg.NetFinish{
+		Frame: atomic.LoadUint32(&p.frame),
 		Cause: msg.NetFinishCause_ServerError,
-	}
+	})
 }
 
 func (p *Player) Update() {
 	p.logInfo(nil, "start")
 	p.updateImpl()
-	p.logInfo(nil, "finish")
+	p.logInfo(p.drifts.fields(), "finish")
 }
 
 func (p *Player) updateImpl() {
-	p.deadline = p.room.CreatedAt().Add(ConnectTimeout)
+	p.deadline = p.room.CreatedAt().Add(p.room.timeouts.Connect)
 
 	updateErr := (func() (err error) {
 		for {
-			size, message, err := p.session.Recv(p.recvBuf, p.channel, p.deadline)
+			if err = p.checkOverflow(); err != nil {
+				return err
+			}
+			deadline := p.deadline
+			if !p.pingAt.IsZero() {
+				if !time.Now().Before(p.pingAt) {
+					if err = p.sendPing(); err != nil {
+						return err
+					}
+				}
+				if p.pingAt.Before(deadline) {
+					deadline = p.pingAt
+				}
+			}
+
+			size, message, err := p.session.Recv(p.recvBuf, p.channel, deadline)
 			if err != nil {
 				if errors.Is(err, kcp.ErrTimeout) {
+					if time.Now().Before(p.deadline) {
+						continue // time to ping
+					}
 					if p.state == msg.NetPlayerState_Running {
-						return errors.WithStack(ErrTimeOutOfSync)
+						since := p.commandAt
+						if since.IsZero() {
+							since = p.room.StartedAt()
+						}
+						return p.syncError(ErrTimeOutOfSync, msg.NetFinishCode_CodeReceiveTimeout, p.frame,
+							"no command for %s", time.Since(since).Round(time.Millisecond))
 					} else {
-						return errors.WithStack(ErrNetworkBroken)
+						return newFinishError(ErrNetworkBroken, msg.NetFinishCode_CodeConnectTimeout,
+							"not started in %s", time.Since(p.room.CreatedAt()).Round(time.Second))
 					}
 				} else {
 					return errors.WithStack(err)
@@ -133,6 +246,10 @@ func (p *Player) updateImpl() {
 
 			} else if message != nil {
 				for message != nil {
+					p.unqueue(messageSize(message))
+					if err = p.checkOverflow(); err != nil {
+						return err
+					}
 					err = p.handleChan(message)
 					if err != nil {
 						return err
@@ -165,10 +282,24 @@ func (p *Player) updateImpl() {
 }
 
 func (p *Player) handleKCP(buffer []byte) (err error) {
+	if err = p.checkBytes(len(buffer)); err != nil {
+		return err
+	}
+
 	message, offset, err := DecodeMessage(buffer)
 	if err != nil {
 		return err
 	}
+	// out-of-band messages and pongs aren't bound to frames
+	if p.state == msg.NetPlayerState_Running {
+		switch message.(type) {
+		case *msg.NetMessage, *msg.NetPong:
+		default:
+			if err = p.checkPackets(); err != nil {
+				return err
+			}
+		}
+	}
 
 	p.logDebug("Recv", message)
 
@@ -178,10 +309,13 @@ func (p *Player) handleKCP(buffer []byte) (err error) {
 		case *msg.NetConnect:
 			if err = p.onConnect(x); err == nil {
 				p.updateState(msg.NetPlayerState_Waiting)
-				p.deadline = p.room.CreatedAt().Add(StartTimeout + SyncLowLimit)
+				p.deadline = p.room.CreatedAt().Add(p.room.timeouts.Start + p.room.timeouts.SyncLow)
+				p.pingAt = time.Now()
+				p.room.observer.PlayerConnected(p.RoomId(), p.Conv(), p.PlayerId())
 			}
 			return err
 		case *msg.NetFinish:
+			p.cause = x.Cause
 			return errors.Wrapf(ErrRemoteFinish, "cause(%d)", x.Cause)
 		default:
 			return errors.WithStack(ErrPacketBroken)
@@ -189,7 +323,14 @@ func (p *Player) handleKCP(buffer []byte) (err error) {
 
 	case msg.NetPlayerState_Waiting:
 		switch x := message.(type) {
+		case *msg.NetTimeSync:
+			return p.onTimeSync(x)
+		case *msg.NetPong:
+			return p.onPong(x)
+		case *msg.NetMessage:
+			return p.onKCPMessage(x)
 		case *msg.NetFinish:
+			p.cause = x.Cause
 			return errors.Wrapf(ErrRemoteFinish, "cause(%d)", x.Cause)
 		default:
 			return errors.WithStack(ErrPacketBroken)
@@ -199,12 +340,46 @@ func (p *Player) handleKCP(buffer []byte) (err error) {
 		switch x := message.(type) {
 		case *msg.NetHash:
 			return p.onHash(x)
+		case *msg.NetTimeSync:
+			// the last player to connect starts running at once
+			return p.onTimeSync(x)
+		case *msg.NetPong:
+			return p.onPong(x)
+		case *msg.NetPause:
+			if err = p.room.Pause(p.Conv()); err != nil {
+				p.logInfo(LogFields{"error": err.Error()}, "pause rejected")
+			}
+			return nil
+		case *msg.NetResume:
+			if err = p.room.Resume(p.Conv()); err != nil {
+				p.logInfo(LogFields{"error": err.Error()}, "resume rejected")
+			}
+			return nil
+		case *msg.NetVote:
+			if err = p.room.StartVote(p.Conv(), x.Kind); err != nil {
+				p.logInfo(LogFields{"error": err.Error()}, "vote rejected")
+			}
+			return nil
+		case *msg.NetBallot:
+			if err = p.room.CastBallot(p.Conv(), x.VoteId, x.Agree); err != nil {
+				p.logInfo(LogFields{"error": err.Error()}, "ballot rejected")
+			}
+			return nil
 		case *msg.NetCommand:
 			if err = p.onKCPCommand(x, offset, buffer); err == nil {
 				p.deadline, err = p.nextDealine()
 			}
+			if err == nil {
+				err = p.hintSpeed()
+			}
 			return err
+		case *msg.NetMessage:
+			return p.onKCPMessage(x)
 		case *msg.NetFinish:
+			if x.Cause == msg.NetFinishCause_Surrender {
+				return errors.WithStack(ErrSurrender)
+			}
+			p.cause = x.Cause
 			return errors.Wrapf(ErrRemoteFinish, "cause(%d)", x.Cause)
 		default:
 			return errors.WithStack(ErrPacketBroken)
@@ -226,10 +401,13 @@ func (p *Player) handleChan(message interface{}) (err error) {
 		switch x := message.(type) {
 		case *msg.NetState:
 			return nil
+		case *msg.NetMessage:
+			return nil
 		case *msg.NetFinish:
 			if err = p.sendToClient(x); err != nil {
 				return err
 			}
+			p.cause = x.Cause
 			return errors.Wrapf(ErrLocalFinish, "cause(%d)", x.Cause)
 		default:
 			return errors.WithStack(ErrMessageType)
@@ -239,16 +417,19 @@ func (p *Player) handleChan(message interface{}) (err error) {
 		switch x := message.(type) {
 		case *msg.NetState:
 			return p.sendToClient(x)
+		case *msg.NetMessage:
+			return p.sendToClient(x)
 		case *msg.NetStart:
 			if err = p.sendToClient(x); err == nil {
 				p.updateState(msg.NetPlayerState_Running)
-				p.deadline = p.room.StartedAt().Add(SyncLowLimit)
+				p.deadline = p.room.StartedAt().Add(p.room.timeouts.SyncLow)
 			}
 			return err
 		case *msg.NetFinish:
 			if err = p.sendToClient(x); err != nil {
 				return err
 			}
+			p.cause = x.Cause
 			return errors.Wrapf(ErrLocalFinish, "cause(%d)", x.Cause)
 		default:
 			return errors.WithStack(ErrMessageType)
@@ -260,10 +441,39 @@ func (p *Player) handleChan(message interface{}) (err error) {
 			return p.sendToClient(x)
 		case *CommandBuffer:
 			return p.onChanCommand(x)
+		case *msg.NetMessage:
+			return p.sendToClient(x)
+		case *msg.NetInputDelay:
+			return p.sendToClient(x)
+		case *msg.NetProgress:
+			return p.sendToClient(x)
+		case *msg.NetVote:
+			return p.sendToClient(x)
+		case *msg.NetBallot:
+			return p.sendToClient(x)
+		case *msg.NetVoteResult:
+			return p.sendToClient(x)
+		case *msg.NetPause:
+			if err = p.sendToClient(x); err == nil {
+				pause := time.Duration(x.Duration) * time.Millisecond
+				p.deadline = time.Now().Add(pause + ResumeCountdown + p.room.timeouts.SyncLow)
+			}
+			return err
+		case *msg.NetResume:
+			if err = p.sendToClient(x); err == nil {
+				countdown := time.Duration(x.Countdown) * time.Millisecond
+				p.deadline = time.Now().Add(countdown + p.room.timeouts.SyncLow)
+			}
+			return err
 		case *msg.NetFinish:
+			// surrendered by team vote, finish like a voluntary surrender
+			if x.Cause == msg.NetFinishCause_Surrender {
+				return errors.WithStack(ErrSurrender)
+			}
 			if err = p.sendToClient(x); err != nil {
 				return err
 			}
+			p.cause = x.Cause
 			return errors.Wrapf(ErrLocalFinish, "cause(%d)", x.Cause)
 		default:
 			return errors.WithStack(ErrMessageType)
@@ -283,14 +493,24 @@ func (p *Player) updateState(state msg.NetPlayerState) msg.NetPlayerState {
 	oldState := p.state
 	atomic.StoreInt32((*int32)(unsafe.Pointer(&p.state)), int32(state))
 
-	p.publishInRoom(false, &msg.NetState{
-		Conv:  p.Conv(),
-		State: p.state,
-	})
+	p.publishInRoom(false, p.netState(state))
 
 	return oldState
 }
 
+func (p *Player) loadState() msg.NetPlayerState {
+	return msg.NetPlayerState(atomic.LoadInt32((*int32)(unsafe.Pointer(&p.state))))
+}
+
+func (p *Player) netState(state msg.NetPlayerState) *msg.NetState {
+	return &msg.NetState{
+		Conv:   p.Conv(),
+		State:  state,
+		Rtt:    uint32(p.RTT().Milliseconds()),
+		Jitter: uint32(p.Jitter().Milliseconds()),
+	}
+}
+
 func (p *Player) onConnect(connect *msg.NetConnect) (err error) {
 	if p.RoomId() != connect.RoomId {
 		return errors.WithStack(ErrAuthFailed)
@@ -310,9 +530,9 @@ func (p *Player) onConnect(connect *msg.NetConnect) (err error) {
 	players := p.room.GetPlayers([]*Player{})
 	for _, player := range players {
 		if p != player {
-			state := msg.NetPlayerState(atomic.LoadInt32((*int32)(unsafe.Pointer(&player.state))))
+			state := player.loadState()
 			if state != msg.NetPlayerState_Initing {
-				err = player.sendToClient(&msg.NetState{Conv: player.Conv(), State: state})
+				err = p.sendToClient(player.netState(state))
 				if err != nil {
 					return err
 				}
@@ -325,31 +545,78 @@ func (p *Player) onConnect(connect *msg.NetConnect) (err error) {
 		return err
 	}
 	if running {
-		p.publishInRoom(true, &msg.NetStart{})
+		p.publishInRoom(true, p.room.netStart())
 	}
 
 	return nil
 }
 
 func (p *Player) nextDealine() (time.Time, error) {
-	remote := p.room.StartedAt().Add(time.Second / FPS * time.Duration(p.frame))
-	now := time.Now()
-	low := now.Add(-SyncLowLimit)
-	high := now.Add(SyncHighLimit)
-	if remote.Before(low) || remote.After(high) {
-		return TimeZero, errors.WithStack(ErrTimeOutOfSync)
+	now := p.room.Now()
+	remote := now.Add(p.drift())
+	low := now.Add(-p.room.timeouts.SyncLow)
+	high := now.Add(p.room.timeouts.SyncHigh)
+	if remote.Before(low) {
+		return TimeZero, p.syncError(ErrTimeOutOfSync, msg.NetFinishCode_CodeTimeBehind, p.frame,
+			"behind by %s", now.Sub(remote).Round(time.Millisecond))
+	}
+	if remote.After(high) {
+		return TimeZero, p.syncError(ErrTimeOutOfSync, msg.NetFinishCode_CodeTimeAhead, p.frame,
+			"ahead by %s", remote.Sub(now).Round(time.Millisecond))
+	}
+	// a paused room keeps the extended deadline
+	deadline := time.Now().Add(now.Sub(low))
+	if deadline.Before(p.deadline) {
+		deadline = p.deadline
 	}
-	deadline := now.Add(now.Sub(low))
 	return deadline, nil
 }
 
+func (p *Player) checkBytes(size int) error {
+	if !p.limiter.Allow(size, time.Now()) {
+		atomic.AddUint64(&stats.FloodBytes, 1)
+		return newFinishError(ErrInputFlood, msg.NetFinishCode_CodeFloodBytes, "bytes per second(%d)", Limits.BytesPerSecond)
+	}
+	return nil
+}
+
+func (p *Player) checkPackets() error {
+	// the count is reset by commands, which don't arrive while the room is paused
+	if p.room.Paused() {
+		return nil
+	}
+	p.packets++
+	if Limits.PacketsPerFrame > 0 && p.packets > Limits.PacketsPerFrame {
+		atomic.AddUint64(&stats.FloodPackets, 1)
+		return newFinishError(ErrInputFlood, msg.NetFinishCode_CodeFloodPackets, "packets per frame(%d)", Limits.PacketsPerFrame)
+	}
+	return nil
+}
+
 func (p *Player) onKCPCommand(cmd *msg.NetCommand, inOffset int, inBuffer []byte) error {
 	if cmd.Frame != p.frame+1 {
-		return errors.WithStack(ErrTimeOutOfSync)
+		return p.syncError(ErrTimeOutOfSync, msg.NetFinishCode_CodeFrameSkipped, cmd.Frame,
+			"frame(%d) after frame(%d)", cmd.Frame, p.frame)
+	}
+	if Limits.MaxPayloadSize > 0 && len(inBuffer)-inOffset > Limits.MaxPayloadSize {
+		atomic.AddUint64(&stats.FloodPayload, 1)
+		return newFinishError(ErrInputFlood, msg.NetFinishCode_CodeFloodPayload, "payload size(%d)", len(inBuffer)-inOffset)
 	}
-	p.frame = cmd.Frame
+	payload := inBuffer[inOffset:]
+	if validator := p.room.Validator(); validator != nil {
+		var err error
+		payload, err = validator.Validate(p.config, cmd.Frame, payload)
+		if err != nil {
+			return errors.WithStack(errors.Wrap(ErrInvalidCommand, err.Error()))
+		}
+	}
+	atomic.StoreUint32(&p.frame, cmd.Frame)
+	p.commandAt = time.Now()
+	p.packets = 0
+	p.updateLag(cmd.Frame)
+	p.room.Simulate(p.Conv(), cmd.Frame, payload)
 
-	outBuffer, err := TransfromCommand(cmd, inOffset, inBuffer, p.Conv())
+	outBuffer, err := TransfromCommand(cmd, 0, payload, p.Conv())
 	if err != nil {
 		return err
 	}
@@ -359,31 +626,58 @@ func (p *Player) onKCPCommand(cmd *msg.NetCommand, inOffset int, inBuffer []byte
 		Buffer:     outBuffer,
 	})
 
+	return p.releaseCommands()
+}
+
+// releaseCommands sends the held commands released by the current frame.
+func (p *Player) releaseCommands() error {
 	p.cmdBufs = p.cmdBufs[:0]
-	for p.cmdHeap.Len() > 0 {
+	for p.cmdHeap.Len() > 0 && p.cmdHeap.PeekKey() <= p.frame {
 		for len(p.cmdBufs) < sendBufSize &&
 			p.cmdHeap.Len() > 0 &&
-			p.cmdHeap.Peek().Frame <= p.frame {
-			buf := p.cmdHeap.Pop().Buffer
+			p.cmdHeap.PeekKey() <= p.frame {
+			cmd := p.cmdHeap.Pop()
+			p.unqueue(messageSize(cmd))
+			buf := cmd.Buffer
 			p.cmdBufs = append(p.cmdBufs, buf)
 
 			p.logDebug("Send", buf)
 		}
 
-		if len(p.cmdBufs) > 0 {
-			_, err = p.session.SendBatch(p.cmdBufs, time.Now().Add(time.Millisecond*10))
-			p.cmdBufs = p.cmdBufs[:0]
-			if err != nil {
-				return err
-			}
+		_, err := p.session.SendBatch(p.cmdBufs, time.Now().Add(time.Millisecond*10))
+		p.cmdBufs = p.cmdBufs[:0]
+		if err != nil {
+			return err
 		}
 	}
-
 	return nil
 }
 
+func (p *Player) updateLag(frame uint32) {
+	expected := p.room.StartedAt().Add(time.Second / FPS * time.Duration(frame))
+	sample := p.room.Now().Sub(expected)
+
+	lag, dev := p.Lag(), time.Duration(atomic.LoadInt64(&p._lagDev))
+	if frame == 1 {
+		lag, dev = sample, 0
+	} else {
+		diff := lag - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		dev = (dev*3 + diff) / 4
+		lag = (lag*7 + sample) / 8
+	}
+	atomic.StoreInt64(&p._lag, int64(lag))
+	atomic.StoreInt64(&p._lagDev, int64(dev))
+	p.room.progress.record(p.Conv(), frame, sample)
+
+	p.room.UpdateInputDelay()
+}
+
 func (p *Player) onChanCommand(buf *CommandBuffer) error {
-	if buf.PlayerTeam == p.config.Team || buf.Frame <= p.frame {
+	release := p.room.policy.Release(buf.PlayerTeam, p.config.Team, buf.Frame)
+	if release <= p.frame {
 		p.logDebug("Send", buf)
 
 		sent, err := p.session.Send(buf.Buffer, time.Now().Add(time.Millisecond*5))
@@ -395,16 +689,94 @@ func (p *Player) onChanCommand(buf *CommandBuffer) error {
 		}
 
 	} else {
-		p.cmdHeap.Push(buf)
+		// held commands stay in the budget until released
+		if !p.queue(messageSize(buf)) {
+			p.overflow()
+			return p.checkOverflow()
+		}
+		p.cmdHeap.PushAt(release, buf)
 	}
 
 	return nil
 }
 
-func (p *Player) onHash(hash *msg.NetHash) error {
+func (p *Player) onKCPMessage(message *msg.NetMessage) error {
+	if !p.msgLimit.Allow(1, time.Now()) {
+		atomic.AddUint64(&stats.MessagesDropped, 1)
+		return nil
+	}
+	message.Conv = p.Conv()
+
+	switch message.Scope {
+	case msg.NetScope_AllPlayers:
+		p.publishInRoom(false, message)
+	case msg.NetScope_SameTeam:
+		defer func() { p.players = p.players[:0] }()
+		p.players = p.room.GetPlayers(p.players)
+		for _, player := range p.players {
+			if player != p && player.config.Team == p.config.Team {
+				player.deliver(message)
+			}
+		}
+	case msg.NetScope_OnePlayer:
+		if player := p.room.GetPlayer(message.Target); player != nil && player != p {
+			player.deliver(message)
+		}
+	default:
+		return errors.WithStack(ErrPacketBroken)
+	}
+	return nil
+}
+
+func (p *Player) onTimeSync(sync *msg.NetTimeSync) error {
+	sync.ServerRecv = time.Now().UnixMilli()
+	sync.ServerSend = time.Now().UnixMilli()
+	return p.sendToClient(sync)
+}
+
+func (p *Player) sendPing() error {
+	now := time.Now()
+	p.pingSeq++
+	p.pingAt = now.Add(PingInterval)
+	p.pingSent[p.pingSeq%pingHistory] = now
+	return p.sendToClient(&msg.NetPing{
+		Seq:  p.pingSeq,
+		Time: now.UnixMilli(),
+	})
+}
+
+func (p *Player) onPong(pong *msg.NetPong) error {
+	if pong.Seq > p.pingSeq {
+		return errors.WithStack(ErrPacketBroken)
+	}
+	if pong.Seq <= p.pongSeq || p.pingSeq-pong.Seq >= pingHistory {
+		return nil // duplicated or too late
+	}
+	p.pongSeq = pong.Seq
+
+	// measured by the server's own sending time, the echoed time is up to the client.
+	// smoothed like TCP, RFC 6298
+	sample := time.Since(p.pingSent[pong.Seq%pingHistory])
+	rtt, jitter := p.RTT(), p.Jitter()
+	if rtt == 0 && jitter == 0 {
+		rtt, jitter = sample, sample/2
+	} else {
+		diff := rtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		jitter = (jitter*3 + diff) / 4
+		rtt = (rtt*7 + sample) / 8
+	}
+	atomic.StoreInt64(&p._rtt, int64(rtt))
+	atomic.StoreInt64(&p._jitter, int64(jitter))
 	return nil
 }
 
+func (p *Player) onHash(hash *msg.NetHash) error {
+	return p.room.VerifyHash(p.Conv(), hash.Frame, hash.Hash)
+}
+
 func (p *Player) sendToClient(message proto.Message) (err error) {
 	defer func() { p.sendBuf = p.sendBuf[:0] }()
 
@@ -431,7 +803,7 @@ func (p *Player) publishInRoom(self bool, message interface{}) {
 	p.players = p.room.GetPlayers(p.players)
 	for _, player := range p.players {
 		if self || player != p {
-			player.channel <- message
+			player.deliver(message)
 		}
 	}
 }
@@ -447,17 +819,27 @@ func (p *Player) handleError(err error) {
 	}, "state change")
 
 	oldState := p.state
-	p.state = msg.NetPlayerState_Stopped
+	atomic.StoreInt32((*int32)(unsafe.Pointer(&p.state)), int32(msg.NetPlayerState_Stopped))
+	defer func() { p.room.observer.PlayerFinished(p.RoomId(), p.Conv(), p.PlayerId(), p.cause) }()
+	if oldState == msg.NetPlayerState_Running {
+		p.room.Abandon(p.Conv(), p.frame)
+	}
 
 	if errors.Is(err, ErrRemoteFinish) || errors.Is(err, ErrLocalFinish) {
 		p.deadline = time.Now()
 		return
 	}
 
+	// only surrendered or disconnected players are eliminated, a server fault or
+	// a kick by the server doesn't decide the outcome
+	if oldState == msg.NetPlayerState_Running && (errors.Is(err, ErrSurrender) || errors.Is(err, ErrNetworkBroken)) {
+		defer p.room.CheckOutcome()
+	}
+
 	var cause msg.NetFinishCause
 	if errors.Is(err, ErrNetworkBroken) {
 		cause = msg.NetFinishCause_NetworkBroken
-	} else if errors.Is(err, ErrPacketBroken) || errors.Is(err, ErrPacketSize) {
+	} else if errors.Is(err, ErrPacketBroken) || errors.Is(err, ErrPacketSize) || errors.Is(err, ErrInvalidCommand) {
 		cause = msg.NetFinishCause_InvalidPacket
 	} else if errors.Is(err, ErrAuthFailed) {
 		cause = msg.NetFinishCause_AuthFailed
@@ -465,14 +847,32 @@ func (p *Player) handleError(err error) {
 		cause = msg.NetFinishCause_TimeOutOfSync
 	} else if errors.Is(err, ErrDataOutOfSync) {
 		cause = msg.NetFinishCause_DataOutOfSync
+	} else if errors.Is(err, ErrInputFlood) {
+		cause = msg.NetFinishCause_InputFlood
+	} else if errors.Is(err, ErrSurrender) {
+		cause = msg.NetFinishCause_Surrender
+	} else if errors.Is(err, ErrSlowReceiver) {
+		cause = msg.NetFinishCause_SlowReceiver
 	} else {
 		cause = msg.NetFinishCause_ServerError
 	}
+	p.cause = cause
 
-	e := p.sendToClient(&msg.NetFinish{
+	finish := &msg.NetFinish{
 		Frame: p.frame,
 		Cause: cause,
-	})
+	}
+	diagnose(err).apply(finish)
+	p.logInfo(LogFields{
+		"cause":          cause,
+		"code":           finish.Code,
+		"detail":         finish.Detail,
+		"expected_frame": finish.ExpectedFrame,
+		"received_frame": finish.ReceivedFrame,
+		"skew":           finish.Skew,
+	}, "finish diagnostics")
+
+	e := p.sendToClient(finish)
 	if e == nil {
 		p.deadline = time.Now().Add(time.Second * 5)
 	} else {
@@ -480,16 +880,17 @@ func (p *Player) handleError(err error) {
 		p.logError(e)
 	}
 
-	if oldState == msg.NetPlayerState_Initing || oldState == msg.NetPlayerState_Waiting {
+	// a room with quorum goes on without the player
+	if !p.room.options.Quorum() &&
+		(oldState == msg.NetPlayerState_Initing || oldState == msg.NetPlayerState_Waiting) {
 		p.publishInRoom(false, &msg.NetFinish{
 			Frame: 0,
 			Cause: msg.NetFinishCause_OtherPlayer,
 		})
 	} else {
-		p.publishInRoom(false, &msg.NetState{
-			Conv:  p.Conv(),
-			State: p.state,
-		})
+		state := p.netState(p.state)
+		state.Cause = cause
+		p.publishInRoom(false, state)
 	}
 }
 
@@ -501,6 +902,8 @@ func (p *Player) logError(err error) {
 		"conv":      p.Conv(),
 		"state":     p.state,
 		"frame":     p.frame,
+		"rtt":       p.RTT().Milliseconds(),
+		"jitter":    p.Jitter().Milliseconds(),
 	}, err)
 }
 
@@ -514,6 +917,8 @@ func (p *Player) logInfo(fields LogFields, args ...interface{}) {
 	fields["conv"] = p.Conv()
 	fields["state"] = p.state
 	fields["frame"] = p.frame
+	fields["rtt"] = p.RTT().Milliseconds()
+	fields["jitter"] = p.Jitter().Milliseconds()
 	LogPrint(LevelInfo, fields, args...)
 }
 
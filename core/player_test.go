@@ -7,12 +7,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestNewPlayer(t *testing.T) {
-	room := NewRoom(tRid, tDura, tCfgs, tChan)
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
 	sess := &MockSession{}
 	sess.On("GetConv").Return(uint32(123))
 
@@ -34,7 +35,7 @@ func prepare() (*MockSession, *Room, *Player, *Player) {
 	sess := &MockSession{}
 	sess.On("GetConv").Return(uint32(123))
 
-	room := NewRoom(tRid, tDura, tCfgs, tChan)
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
 	room._startedAt = time.Now().UnixMilli()
 
 	player1, err := NewPlayer(tCfg1, room, sess)
@@ -94,6 +95,35 @@ func TestPlayerKCPIniting(t *testing.T) {
 	assert.ErrorIs(t, err, ErrPacketBroken)
 }
 
+func TestPlayerLateConnect(t *testing.T) {
+	sess1 := &MockSession{}
+	sess1.On("GetConv").Return(tCfg1.Conv)
+	sess2 := &MockSession{}
+	sess2.On("GetConv").Return(tCfg2.Conv)
+
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	player1, _ := NewPlayer(tCfg1, room, sess1)
+	room._players[tCfg1.Conv] = player1
+	player2, _ := NewPlayer(tCfg2, room, sess2)
+	room._players[tCfg2.Conv] = player2
+	player2.state = msg.NetPlayerState_Waiting
+
+	// the states of the others go to the session of the late connector only
+	buffer, _ := EncodeMessage(&msg.NetAccept{}, []byte{})
+	sess1.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	buffer, _ = EncodeMessage(player2.netState(msg.NetPlayerState_Waiting), []byte{})
+	sess1.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+
+	err := player1.onConnect(&msg.NetConnect{
+		RoomId:   tRid,
+		PlayerId: tCfg1.PlayerId,
+		Password: tCfg1.Password,
+	})
+	assert.Equal(t, nil, err)
+	sess1.AssertNumberOfCalls(t, "Send", 2)
+	sess2.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
 func TestPlayerKCPWaiting(t *testing.T) {
 	var buffer []byte
 	_, _, player, _ := prepare()
@@ -265,6 +295,114 @@ func TestPlayerChanRunning(t *testing.T) {
 	assert.ErrorIs(t, err, ErrMessageType)
 }
 
+func TestPlayerVisibility(t *testing.T) {
+	sess, room, player, _ := prepare()
+	player.state = msg.NetPlayerState_Running
+	player.frame = 2
+	room.policy = FixedDelay{3}
+
+	buffer := []byte{9, 9, 9, 9}
+	err := player.handleChan(&CommandBuffer{Frame: 1, PlayerTeam: Team2, Buffer: buffer})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, player.cmdHeap.Len())
+	assert.Equal(t, uint32(4), player.cmdHeap.PeekKey())
+
+	player.frame = 3
+	err = player.releaseCommands()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, player.cmdHeap.Len())
+
+	sess.On("SendBatch", [][]byte{buffer}, mock.Anything).Return(len(buffer), nil)
+	player.frame = 4
+	err = player.releaseCommands()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, player.cmdHeap.Len())
+
+	room.policy = AllImmediate{}
+	sess.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	err = player.handleChan(&CommandBuffer{Frame: 9, PlayerTeam: Team2, Buffer: buffer})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, player.cmdHeap.Len())
+	sess.AssertCalled(t, "Send", buffer, mock.Anything)
+}
+
+func TestPlayerSurrender(t *testing.T) {
+	sess, room, player1, _ := prepare()
+	player1.state = msg.NetPlayerState_Running
+	player2, err := NewPlayer(tCfg2, room, sess)
+	assert.Equal(t, nil, err)
+	player2.state = msg.NetPlayerState_Running
+	room._players[tCfg2.Conv] = player2
+	room._state = RoomRunning
+
+	finish := &msg.NetFinish{Cause: msg.NetFinishCause_Surrender}
+	buffer, _ := EncodeMessage(finish, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrSurrender)
+
+	buffer, _ = EncodeMessage(&msg.NetFinish{Cause: msg.NetFinishCause_Surrender}, []byte{})
+	sess.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	player1.handleError(err)
+	assert.Equal(t, msg.NetPlayerState_Stopped, player1.state)
+
+	state := (<-player2.channel).(*msg.NetState)
+	assert.Equal(t, tCfg1.Conv, state.Conv)
+	assert.Equal(t, msg.NetPlayerState_Stopped, state.State)
+	assert.Equal(t, msg.NetFinishCause_Surrender, state.Cause)
+	over := (<-player2.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_GameOver, over.Cause)
+	assert.Equal(t, msg.NetOutcome_Victory, over.Outcome)
+	assert.Equal(t, uint32(Team2), over.WinnerTeam)
+}
+
+func TestPlayerNormalFinish(t *testing.T) {
+	sess, room, player1, _ := prepare()
+	player1.state = msg.NetPlayerState_Running
+	player2, err := NewPlayer(tCfg2, room, sess)
+	assert.Equal(t, nil, err)
+	player2.state = msg.NetPlayerState_Running
+	room._players[tCfg2.Conv] = player2
+	room._state = RoomRunning
+
+	buffer, _ := EncodeMessage(&msg.NetFinish{Cause: msg.NetFinishCause_GameOver}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrRemoteFinish)
+	player1.handleError(err)
+	assert.Equal(t, msg.NetPlayerState_Stopped, player1.state)
+
+	// the other team doesn't win by a normal finish
+	assert.Equal(t, 0, len(player2.channel))
+	assert.False(t, room._gameOver)
+	assert.Equal(t, uint8(0), room._winner)
+
+	player2.handleError(errors.Wrapf(ErrLocalFinish, "cause(%d)", msg.NetFinishCause_Remake))
+	assert.False(t, room._gameOver)
+}
+
+func TestPlayerErrorFinish(t *testing.T) {
+	for _, err := range []error{
+		errors.WithStack(ErrUnexpected),
+		errors.WithStack(ErrSlowReceiver),
+	} {
+		sess, room, player1, _ := prepare()
+		player1.state = msg.NetPlayerState_Running
+		player2, _ := NewPlayer(tCfg2, room, sess)
+		player2.state = msg.NetPlayerState_Running
+		room._players[tCfg2.Conv] = player2
+		room._state = RoomRunning
+		sess.On("Send", mock.Anything, mock.Anything).Return(0, nil)
+
+		player1.handleError(err)
+		assert.Equal(t, msg.NetPlayerState_Stopped, player1.state)
+
+		// the other team doesn't win by a server fault or a kick
+		state := (<-player2.channel).(*msg.NetState)
+		assert.Equal(t, msg.NetPlayerState_Stopped, state.State)
+		assert.Equal(t, 0, len(player2.channel))
+		assert.False(t, room._gameOver)
+	}
+}
+
 func TestPlayerChanStopped(t *testing.T) {
 	var buffer []byte
 	_, _, player, _ := prepare()
@@ -274,3 +412,230 @@ func TestPlayerChanStopped(t *testing.T) {
 	err := player.handleChan(buffer)
 	assert.Equal(t, nil, err)
 }
+
+func TestPlayerKCPFlood(t *testing.T) {
+	var buffer []byte
+	_, _, player, _ := prepare()
+	player.state = msg.NetPlayerState_Running
+
+	buffer, _ = EncodeMessage(&msg.NetHash{}, []byte{})
+	for i := 0; i < Limits.PacketsPerFrame; i++ {
+		err := player.handleKCP(buffer)
+		assert.Equal(t, nil, err)
+	}
+	floods := GetStats().FloodPackets
+	err := player.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrInputFlood)
+	assert.Equal(t, floods+1, GetStats().FloodPackets)
+
+	// packets aren't bound to frames while the room is paused
+	_, room, player, _ := prepare()
+	player.state = msg.NetPlayerState_Running
+	room._pausedAt = time.Now().UnixMilli()
+	for i := 0; i < Limits.PacketsPerFrame*2; i++ {
+		err = player.handleKCP(buffer)
+		assert.Equal(t, nil, err)
+	}
+
+	_, _, player, _ = prepare()
+	player.state = msg.NetPlayerState_Running
+	buffer, _ = EncodeMessage(&msg.NetCommand{Frame: 1}, []byte{})
+	buffer = append(buffer, make([]byte, Limits.MaxPayloadSize+1)...)
+	err = player.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrInputFlood)
+
+	_, _, player, _ = prepare()
+	player.state = msg.NetPlayerState_Running
+	player.limiter = newRateLimiter(10, 10)
+	buffer, _ = EncodeMessage(&msg.NetHash{Hash: make([]byte, 16)}, []byte{})
+	err = player.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrInputFlood)
+}
+
+func TestPlayerKCPValidate(t *testing.T) {
+	var buffer []byte
+	_, room, player1, player2 := prepare()
+	player1.state = msg.NetPlayerState_Running
+	room.options.Validator = ValidatorFunc(func(config *PlayerConfig, frame uint32, payload []byte) ([]byte, error) {
+		assert.Equal(t, tCfg1, config)
+		if frame == 1 {
+			return nil, nil
+		}
+		return nil, ErrUnexpected
+	})
+
+	buffer, _ = EncodeMessage(&msg.NetCommand{Frame: 1}, []byte{})
+	buffer = append(buffer, 9, 8, 7)
+	err := player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(1), player1.frame)
+
+	cb := (<-player2.channel).(*CommandBuffer)
+	cmd, offset, _ := DecodeMessage(cb.Buffer)
+	assert.Equal(t, uint32(1), cmd.(*msg.NetCommand).Frame)
+	assert.Equal(t, len(cb.Buffer), offset)
+
+	buffer, _ = EncodeMessage(&msg.NetCommand{Frame: 2}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrInvalidCommand)
+	assert.Equal(t, uint32(1), player1.frame)
+}
+
+func TestPlayerPause(t *testing.T) {
+	var buffer []byte
+	sess, room, player1, player2 := prepare()
+	room._state = RoomRunning
+	player1.state = msg.NetPlayerState_Running
+
+	buffer, _ = EncodeMessage(&msg.NetPause{}, []byte{})
+	err := player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.True(t, room.Paused())
+	pause := (<-player2.channel).(*msg.NetPause)
+	assert.Equal(t, tCfg1.Conv, pause.Conv)
+	<-player1.channel
+
+	buffer, _ = EncodeMessage(pause, []byte{})
+	sess.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	err = player1.handleChan(pause)
+	assert.Equal(t, nil, err)
+	assert.True(t, player1.deadline.After(time.Now().Add(PauseBudget)))
+
+	buffer, _ = EncodeMessage(&msg.NetResume{}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.False(t, room.Paused())
+	resume := (<-player2.channel).(*msg.NetResume)
+	<-player1.channel
+
+	buffer, _ = EncodeMessage(resume, []byte{})
+	sess.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	err = player1.handleChan(resume)
+	assert.Equal(t, nil, err)
+	assert.True(t, player1.deadline.Before(time.Now().Add(ResumeCountdown+SyncLowLimit+time.Millisecond)))
+}
+
+func TestPlayerMessage(t *testing.T) {
+	var buffer []byte
+	sess, room, player1, player2 := prepare()
+	player2.config = tCfg2
+	player1.state = msg.NetPlayerState_Waiting
+
+	buffer, _ = EncodeMessage(&msg.NetMessage{Scope: msg.NetScope_AllPlayers, Payload: []byte("gg")}, []byte{})
+	err := player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	message := (<-player2.channel).(*msg.NetMessage)
+	assert.Equal(t, tCfg1.Conv, message.Conv)
+	assert.Equal(t, []byte("gg"), message.Payload)
+	assert.Equal(t, 0, len(player1.channel))
+
+	player1.state = msg.NetPlayerState_Running
+	buffer, _ = EncodeMessage(&msg.NetMessage{Scope: msg.NetScope_SameTeam}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(player2.channel))
+
+	buffer, _ = EncodeMessage(&msg.NetMessage{Scope: msg.NetScope_OnePlayer, Target: tCfg2.Conv}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(player2.channel))
+	message = (<-player2.channel).(*msg.NetMessage)
+	buffer, _ = EncodeMessage(message, []byte{})
+	sess.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	err = player1.handleChan(message)
+	assert.Equal(t, nil, err)
+
+	buffer, _ = EncodeMessage(&msg.NetMessage{Scope: 99}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrPacketBroken)
+
+	dropped := GetStats().MessagesDropped
+	buffer, _ = EncodeMessage(&msg.NetMessage{Scope: msg.NetScope_OnePlayer, Target: 999}, []byte{})
+	for i := 0; i < Limits.MessagesPerSecond*2; i++ {
+		err = player1.handleKCP(buffer)
+		assert.Equal(t, nil, err)
+	}
+	assert.True(t, GetStats().MessagesDropped > dropped)
+	assert.Equal(t, 0, len(room.GetPlayer(tCfg2.Conv).channel))
+}
+
+func TestPlayerPing(t *testing.T) {
+	var buffer []byte
+	sess, _, player1, player2 := prepare()
+	player1.state = msg.NetPlayerState_Running
+	sess.On("Send", mock.Anything, mock.Anything).Return(func(buf []byte, _ time.Time) int { return len(buf) }, nil)
+
+	err := player1.sendPing()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(1), player1.pingSeq)
+	assert.True(t, player1.pingAt.After(time.Now().Add(PingInterval-time.Millisecond)))
+
+	buffer, _ = EncodeMessage(&msg.NetPong{Seq: 2, Time: time.Now().UnixMilli()}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.ErrorIs(t, err, ErrPacketBroken)
+
+	// the echoed time doesn't count
+	player1.pingSent[1] = time.Now().Add(-time.Millisecond * 80)
+	buffer, _ = EncodeMessage(&msg.NetPong{Seq: 1, Time: time.Now().Add(-time.Hour).UnixMilli()}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.True(t, player1.RTT() >= time.Millisecond*80)
+	assert.True(t, player1.RTT() < time.Second)
+	assert.Equal(t, player1.RTT()/2, player1.Jitter())
+	assert.Equal(t, 0, len(player2.channel))
+
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+
+	rtt := player1.RTT()
+	player1.sendPing()
+	player1.pingSent[2] = time.Now().Add(-time.Millisecond * 40)
+	buffer, _ = EncodeMessage(&msg.NetPong{Seq: 2}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.True(t, player1.RTT() < rtt)
+
+	// a pong older than the recent pings is ignored
+	rtt = player1.RTT()
+	for i := 0; i < pingHistory; i++ {
+		player1.sendPing()
+	}
+	player1.pongSeq = 0
+	buffer, _ = EncodeMessage(&msg.NetPong{Seq: 2}, []byte{})
+	err = player1.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, rtt, player1.RTT())
+
+	stats := player1.Stats()
+	assert.Equal(t, tCfg1.Conv, stats.Conv)
+	assert.Equal(t, "Running", stats.State)
+	assert.Equal(t, player1.RTT().Milliseconds(), stats.RTT)
+}
+
+func TestPlayerTimeSync(t *testing.T) {
+	var buffer []byte
+	var reply []byte
+	sess, _, player, _ := prepare()
+	player.state = msg.NetPlayerState_Waiting
+	sess.On("Send", mock.Anything, mock.Anything).Return(func(buf []byte, _ time.Time) int {
+		reply = append(reply[:0], buf...)
+		return len(buf)
+	}, nil)
+
+	before := time.Now().UnixMilli()
+	buffer, _ = EncodeMessage(&msg.NetTimeSync{ClientTime: 12345}, []byte{})
+	err := player.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	message, _, _ := DecodeMessage(reply)
+	sync := message.(*msg.NetTimeSync)
+	assert.Equal(t, int64(12345), sync.ClientTime)
+	assert.True(t, sync.ServerRecv >= before)
+	assert.True(t, sync.ServerSend >= sync.ServerRecv)
+
+	player.state = msg.NetPlayerState_Running
+	reply = reply[:0]
+	err = player.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	message, _, _ = DecodeMessage(reply)
+	assert.Equal(t, int64(12345), message.(*msg.NetTimeSync).ClientTime)
+}
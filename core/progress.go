@@ -0,0 +1,165 @@
+package core
+
+import (
+	. "point-set/base"
+	msg "point-set/message"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LagDistribution is the rolling distribution of a player's lag behind the room clock, in ms.
+type LagDistribution struct {
+	Samples int   `json:"samples"`
+	P50     int64 `json:"p50"`
+	P95     int64 `json:"p95"`
+	Max     int64 `json:"max"`
+}
+
+// lagWindow is a ring of the latest LagWindowSize lag samples in ms.
+type lagWindow struct {
+	samples []int64
+	next    int
+}
+
+func (w *lagWindow) push(lag time.Duration) {
+	if len(w.samples) < LagWindowSize {
+		w.samples = append(w.samples, lag.Milliseconds())
+		return
+	}
+	w.samples[w.next] = lag.Milliseconds()
+	w.next = (w.next + 1) % LagWindowSize
+}
+
+func (w *lagWindow) distribution() LagDistribution {
+	if len(w.samples) == 0 {
+		return LagDistribution{}
+	}
+	sorted := append([]int64(nil), w.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return LagDistribution{
+		Samples: len(sorted),
+		P50:     sorted[(len(sorted)-1)*50/100],
+		P95:     sorted[(len(sorted)-1)*95/100],
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+// progress tracks the latest frame and the lag of each player against the room clock.
+type progress struct {
+	_mutex  sync.Mutex
+	_frames map[uint32]uint32
+	_lags   map[uint32]*lagWindow
+}
+
+func newProgress(roster []*msg.NetPlayer) *progress {
+	p := &progress{
+		_mutex:  sync.Mutex{},
+		_frames: make(map[uint32]uint32, len(roster)),
+		_lags:   make(map[uint32]*lagWindow, len(roster)),
+	}
+	for _, player := range roster {
+		p._lags[player.Conv] = &lagWindow{}
+	}
+	return p
+}
+
+func (p *progress) record(conv uint32, frame uint32, lag time.Duration) {
+	p._mutex.Lock()
+	defer p._mutex.Unlock()
+
+	window, ok := p._lags[conv]
+	if !ok {
+		return
+	}
+	p._frames[conv] = frame
+	window.push(lag)
+}
+
+func (p *progress) frame(conv uint32) uint32 {
+	p._mutex.Lock()
+	defer p._mutex.Unlock()
+
+	return p._frames[conv]
+}
+
+func (p *progress) distribution(conv uint32) LagDistribution {
+	p._mutex.Lock()
+	defer p._mutex.Unlock()
+
+	window, ok := p._lags[conv]
+	if !ok {
+		return LagDistribution{}
+	}
+	return window.distribution()
+}
+
+// Progress reports the frame of each player in the roster, and the slowest running player.
+func (r *Room) Progress() *msg.NetProgress {
+	progress := &msg.NetProgress{
+		Frame:   r.Frame(),
+		Players: make([]*msg.NetPlayerProgress, 0, len(r.roster)),
+	}
+	slowest := uint32(0)
+	for _, entry := range r.roster {
+		player := r.GetPlayer(entry.Conv)
+		item := &msg.NetPlayerProgress{
+			Conv:  entry.Conv,
+			Frame: r.progress.frame(entry.Conv),
+		}
+		if player != nil {
+			item.Lag = int32(player.Lag().Milliseconds())
+			item.Rtt = uint32(player.RTT().Milliseconds())
+		}
+		progress.Players = append(progress.Players, item)
+
+		if player == nil || player.loadState() != msg.NetPlayerState_Running {
+			continue
+		}
+		if progress.Slowest == 0 || item.Frame < slowest {
+			progress.Slowest, slowest = item.Conv, item.Frame
+		}
+	}
+	return progress
+}
+
+// reportProgress publishes the progress every ProgressInterval while the room is running,
+// and logs the lag distribution of players every LagLogInterval.
+func (r *Room) reportProgress() {
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+	loggedAt := time.Now()
+	for now := range ticker.C {
+		log := now.Sub(loggedAt) >= LagLogInterval
+		if log {
+			loggedAt = now
+		}
+		if !r.reportProgressOnce(log) {
+			break
+		}
+	}
+}
+
+func (r *Room) reportProgressOnce(log bool) bool {
+	r._mutex.RLock()
+	state := r._state
+	r._mutex.RUnlock()
+	if state != RoomRunning {
+		return false
+	}
+
+	progress := r.Progress()
+	r.Publish(progress)
+	if log {
+		lags := make(map[uint32]LagDistribution, len(r.roster))
+		for _, entry := range r.roster {
+			lags[entry.Conv] = r.progress.distribution(entry.Conv)
+		}
+		r.logInfo(LogFields{
+			"frame":   progress.Frame,
+			"slowest": progress.Slowest,
+			"lags":    lags,
+		}, "room progress")
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	. "point-set/base"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLagWindow(t *testing.T) {
+	w := lagWindow{}
+	assert.Equal(t, LagDistribution{}, w.distribution())
+
+	for i := 1; i <= 100; i++ {
+		w.push(time.Millisecond * time.Duration(i))
+	}
+	assert.Equal(t, LagDistribution{Samples: 100, P50: 50, P95: 95, Max: 100}, w.distribution())
+
+	for i := 0; i < LagWindowSize; i++ {
+		w.push(time.Millisecond * 10)
+	}
+	assert.Equal(t, LagWindowSize, len(w.samples))
+	assert.Equal(t, LagDistribution{Samples: LagWindowSize, P50: 10, P95: 10, Max: 10}, w.distribution())
+}
+
+func TestRoomProgress(t *testing.T) {
+	_, room, player1, player2 := prepare()
+	room._state = RoomRunning
+	room._startedAt = time.Now().Add(-time.Second * 3).UnixMilli()
+	player1.state = msg.NetPlayerState_Running
+	player2.state = msg.NetPlayerState_Running
+
+	room.progress.record(tCfg1.Conv, 28, time.Millisecond*200)
+	room.progress.record(tCfg2.Conv, 25, time.Millisecond*500)
+	room.progress.record(777, 1, 0)
+	player1._rtt = int64(time.Millisecond * 120)
+
+	progress := room.Progress()
+	assert.InDelta(t, 30, progress.Frame, 1)
+	assert.Equal(t, 2, len(progress.Players))
+	assert.Equal(t, tCfg1.Conv, progress.Players[0].Conv)
+	assert.Equal(t, uint32(28), progress.Players[0].Frame)
+	assert.Equal(t, uint32(25), progress.Players[1].Frame)
+	assert.Equal(t, uint32(120), progress.Players[0].Rtt)
+	assert.Equal(t, tCfg2.Conv, progress.Slowest)
+
+	player2.state = msg.NetPlayerState_Stopped
+	assert.Equal(t, tCfg1.Conv, room.Progress().Slowest)
+
+	stats := room.Stats()
+	assert.Equal(t, tCfg1.Conv, stats.Slowest)
+	for _, player := range stats.Players {
+		assert.Equal(t, 1, player.Lags.Samples)
+	}
+
+	assert.True(t, room.reportProgressOnce(true))
+	_, ok := (<-player1.channel).(*msg.NetProgress)
+	assert.True(t, ok)
+
+	room._state = RoomStopped
+	assert.False(t, room.reportProgressOnce(false))
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	. "point-set/base"
+	. "point-set/codec"
+	msg "point-set/message"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// messageOverhead is the accounted memory of a queued message besides its payload.
+const messageOverhead = 64
+
+func messageSize(message interface{}) int64 {
+	switch x := message.(type) {
+	case *CommandBuffer:
+		return int64(len(x.Buffer)) + messageOverhead
+	case proto.Message:
+		return int64(proto.Size(x)) + messageOverhead
+	default:
+		return messageOverhead
+	}
+}
+
+// deliver queues a message to the player without blocking. A player over ChannelSize
+// or MaxQueuedBytes is overflowed, the message is dropped and the player is finished
+// with the SlowReceiver cause by its own goroutine, so a slow player can't block the room.
+// Stopped players don't drain the channel, messages to them are dropped.
+func (p *Player) deliver(message interface{}) bool {
+	if atomic.LoadInt32(&p._overflow) != 0 || p.loadState() == msg.NetPlayerState_Stopped {
+		return false
+	}
+	size := messageSize(message)
+	if p.queue(size) {
+		select {
+		case p.channel <- message:
+			return true
+		default:
+			p.unqueue(size)
+		}
+	}
+
+	p.overflow()
+	return false
+}
+
+func (p *Player) overflow() {
+	if atomic.CompareAndSwapInt32(&p._overflow, 0, 1) {
+		atomic.AddUint64(&stats.SlowReceivers, 1)
+		p.logInfo(LogFields{
+			"queued":   atomic.LoadInt64(&p._queued),
+			"messages": len(p.channel),
+		}, "queue overflow")
+	}
+}
+
+// queue accounts bytes queued to the player, returns false over MaxQueuedBytes.
+func (p *Player) queue(size int64) bool {
+	if atomic.AddInt64(&p._queued, size) > MaxQueuedBytes {
+		atomic.AddInt64(&p._queued, -size)
+		return false
+	}
+	return true
+}
+
+func (p *Player) unqueue(size int64) {
+	atomic.AddInt64(&p._queued, -size)
+}
+
+// checkOverflow returns ErrSlowReceiver once a message to the player is dropped.
+func (p *Player) checkOverflow() error {
+	if atomic.LoadInt32(&p._overflow) == 0 {
+		return nil
+	}
+	return newFinishError(ErrSlowReceiver, msg.NetFinishCode_CodeQueueOverflow,
+		"queue over %d messages or %d bytes", ChannelSize, MaxQueuedBytes)
+}
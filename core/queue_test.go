@@ -0,0 +1,118 @@
+package core
+
+import (
+	. "point-set/base"
+	. "point-set/codec"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// publishes in a goroutine, fails if blocked
+func assertNotBlocked(t *testing.T, publish func()) {
+	done := make(chan struct{})
+	go func() {
+		publish()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("blocked by a slow receiver")
+	}
+}
+
+func TestPlayerDeliver(t *testing.T) {
+	_, _, player, _ := prepare()
+
+	finish := &msg.NetFinish{}
+	assert.True(t, player.deliver(finish))
+	assert.Equal(t, messageSize(finish), player._queued)
+	assert.Equal(t, nil, player.checkOverflow())
+
+	slowReceivers := GetStats().SlowReceivers
+	assertNotBlocked(t, func() {
+		for i := 0; i < ChannelSize*2; i++ {
+			player.deliver(&msg.NetState{})
+		}
+	})
+	assert.Equal(t, ChannelSize, len(player.channel))
+	assert.Equal(t, slowReceivers+1, GetStats().SlowReceivers)
+	err := player.checkOverflow()
+	assert.ErrorIs(t, err, ErrSlowReceiver)
+	assert.Equal(t, msg.NetFinishCode_CodeQueueOverflow, diagnose(err).code)
+	assert.False(t, player.deliver(&msg.NetState{}))
+
+	_, _, player, _ = prepare()
+	buffer := make([]byte, MaxPacketSize)
+	assertNotBlocked(t, func() {
+		for i := 0; i < MaxQueuedBytes/MaxPacketSize+1; i++ {
+			player.deliver(&CommandBuffer{Buffer: buffer})
+		}
+	})
+	assert.True(t, len(player.channel) < ChannelSize)
+	assert.True(t, player._queued <= MaxQueuedBytes)
+	assert.ErrorIs(t, player.checkOverflow(), ErrSlowReceiver)
+}
+
+func TestPlayerHeldCommands(t *testing.T) {
+	_, room, player, _ := prepare()
+	player.state = msg.NetPlayerState_Running
+	room.policy = FixedDelay{Frames: 1000}
+
+	buffer := make([]byte, MaxPacketSize)
+	var err error
+	for i := 0; err == nil && i < MaxQueuedBytes/MaxPacketSize+1; i++ {
+		err = player.handleChan(&CommandBuffer{Frame: uint32(i), PlayerTeam: Team2, Buffer: buffer})
+	}
+	assert.ErrorIs(t, err, ErrSlowReceiver)
+	assert.True(t, player.cmdHeap.Len() <= MaxQueuedBytes/MaxPacketSize)
+	assert.True(t, player._queued <= MaxQueuedBytes)
+}
+
+func TestRoomSlowReceiver(t *testing.T) {
+	sess, room, player1, player2 := prepare()
+	player1.state = msg.NetPlayerState_Running
+	player2.state = msg.NetPlayerState_Running
+
+	// player2 never drains its channel
+	assertNotBlocked(t, func() {
+		for i := 0; i < ChannelSize*2; i++ {
+			room.Publish(&msg.NetInputDelay{Frames: 1})
+			if i%4 != 0 {
+				<-player1.channel
+				player1.unqueue(messageSize(&msg.NetInputDelay{Frames: 1}))
+			}
+		}
+		room.Close()
+	})
+	assert.Equal(t, nil, player1.checkOverflow())
+	assert.ErrorIs(t, player2.checkOverflow(), ErrSlowReceiver)
+
+	// the slow player is finished with the SlowReceiver cause
+	finish := &msg.NetFinish{Frame: player2.frame, Cause: msg.NetFinishCause_SlowReceiver}
+	diagnose(player2.checkOverflow()).apply(finish)
+	buffer, _ := EncodeMessage(finish, []byte{})
+	sess.On("Send", buffer, mock.Anything).Return(len(buffer), nil)
+	player2.handleError(errors.WithStack(player2.checkOverflow()))
+	assert.Equal(t, msg.NetFinishCause_SlowReceiver, player2.cause)
+	sess.AssertCalled(t, "Send", buffer, mock.Anything)
+
+	// a finished player doesn't drain its channel, but isn't a slow receiver
+	_, room, player1, player2 = prepare()
+	player1.state = msg.NetPlayerState_Stopped
+	player2.state = msg.NetPlayerState_Stopped
+	slowReceivers := GetStats().SlowReceivers
+	assertNotBlocked(t, func() {
+		for i := 0; i < ChannelSize*2; i++ {
+			room.Publish(&msg.NetInputDelay{Frames: 1})
+		}
+	})
+	assert.Equal(t, 0, len(player1.channel))
+	assert.Equal(t, nil, player1.checkOverflow())
+	assert.Equal(t, slowReceivers, GetStats().SlowReceivers)
+}
@@ -1,12 +1,18 @@
 package core
 
 import (
+	"io"
+	"math"
 	. "point-set/base"
+	. "point-set/codec"
+	msg "point-set/message"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -15,12 +21,150 @@ const (
 	RoomStopped uint8 = 3
 )
 
+type RoomOptions struct {
+	Mode string `json:"mode"`
+
+	// start without absent players after the start timeout, 0 means all players are required
+	MinPlayers     int `json:"min_players"`
+	MinTeamPlayers int `json:"min_team_players"`
+
+	// inject empty commands for stopped players at the room's pace
+	SynthesizeInputs bool `json:"synthesize_inputs"`
+
+	// delivered in NetStart, a random seed is generated if 0
+	Seed     uint64 `json:"seed"`
+	Settings []byte `json:"settings,omitempty"`
+
+	// when other teams' commands are visible, see NewVisibility
+	Visibility      string    `json:"visibility"`
+	VisibilityDelay uint32    `json:"visibility_delay"`
+	Alliances       [][]uint8 `json:"alliances"`
+
+	// fraction of voters to exceed for a vote to pass, 0 means DefaultVoteMajority
+	VoteMajority float64 `json:"vote_majority"`
+
+	// flag players whose NetHash disagrees with the simulator, and finish them if set
+	FinishOnDesync bool `json:"finish_on_desync"`
+
+	// name of the rule module loaded by RulesLoader, replaces the validator and simulator of the mode
+	Rules string `json:"rules"`
+
+	// overrides the default timeouts in base, zero fields keep the defaults
+	Timeouts Timeouts `json:"timeouts"`
+
+	// resolved by RoomManager
+	Validator CommandValidator `json:"-"`
+	Simulator Simulator        `json:"-"`
+	Observer  Observer         `json:"-"`
+}
+
+func (o *RoomOptions) Quorum() bool {
+	return o.MinPlayers > 0 || o.MinTeamPlayers > 0
+}
+
+func (o *RoomOptions) validate(players []PlayerBasic) error {
+	if o.MinPlayers < 0 || o.MinPlayers > len(players) || o.MinTeamPlayers < 0 ||
+		o.VoteMajority < 0 || o.VoteMajority > 1 {
+		return errors.WithStack(ErrArguments)
+	}
+	teams := make(map[uint8]int, 4)
+	for _, player := range players {
+		teams[player.Team]++
+	}
+	for _, count := range teams {
+		if o.MinTeamPlayers > count {
+			return errors.WithStack(ErrArguments)
+		}
+	}
+	if _, err := NewVisibility(o); err != nil {
+		return err
+	}
+	if err := o.Timeouts.resolve().validate(); err != nil {
+		return err
+	}
+
+	// the roster and settings must fit in a single NetStart packet
+	start := &msg.NetStart{
+		StartTime:  math.MaxInt64,
+		InputDelay: MaxInputDelay,
+		Players:    make([]*msg.NetPlayer, 0, len(players)),
+		Seed:       math.MaxUint64,
+		Settings:   o.Settings,
+	}
+	for _, player := range players {
+		start.Players = append(start.Players, &msg.NetPlayer{
+			Conv:     math.MaxUint32,
+			PlayerId: player.PlayerId,
+			Team:     uint32(player.Team),
+			Metadata: player.Metadata,
+		})
+	}
+	_, err := EncodeMessage(start, make([]byte, 0, MaxPacketSize))
+	if errors.Is(err, ErrMessageSize) {
+		return errors.Wrapf(ErrArguments, "roster size(%d)", proto.Size(start))
+	}
+	return err
+}
+
+// newRoster lists the players sorted by conv, so that all clients see the same order.
+func newRoster(configs map[uint32]*PlayerConfig) []*msg.NetPlayer {
+	roster := make([]*msg.NetPlayer, 0, len(configs))
+	for _, config := range configs {
+		roster = append(roster, &msg.NetPlayer{
+			Conv:     config.Conv,
+			PlayerId: config.PlayerId,
+			Team:     uint32(config.Team),
+			Metadata: config.Metadata,
+		})
+	}
+	sort.Slice(roster, func(i, j int) bool { return roster[i].Conv < roster[j].Conv })
+	return roster
+}
+
+type RoomStats struct {
+	RoomId     string        `json:"room_id"`
+	State      uint8         `json:"state"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  time.Time     `json:"started_at"`
+	Paused     bool          `json:"paused"`
+	InputDelay uint32        `json:"input_delay"`
+	Frame      uint32        `json:"frame"`   // frame of the room clock
+	Slowest    uint32        `json:"slowest"` // conv of the slowest running player, 0 if none
+	Players    []PlayerStats `json:"players"`
+}
+
+// RoomSummary is the record of a finished room.
+type RoomSummary struct {
+	RoomId     string          `json:"room_id"`
+	Mode       string          `json:"mode"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  time.Time       `json:"started_at"` // zero if never started
+	FinishedAt time.Time       `json:"finished_at"`
+	WinnerTeam uint8           `json:"winner_team"` // 0 if undecided
+	Players    []PlayerSummary `json:"players"`
+}
+
+type PlayerSummary struct {
+	Conv     uint32 `json:"conv"`
+	PlayerId string `json:"player_id"`
+	Team     uint8  `json:"team"`
+	Frame    uint32 `json:"frame"` // final frame
+	Cause    string `json:"cause"` // finish cause, empty if never entered
+}
+
 type Room struct {
 	roomId    string
 	createdAt time.Time
 	duration  time.Duration
 	maxFrame  uint32
 	configs   map[uint32]*PlayerConfig
+	roster    []*msg.NetPlayer
+	options   RoomOptions
+	timeouts  Timeouts
+	policy    Visibility
+	sim       *simulation
+	progress  *progress
+	observer  Observer
 	chFinish  chan<- string
 
 	// multi-thread fields
@@ -29,12 +173,37 @@ type Room struct {
 	_readySet  map[uint32]bool
 	_players   map[uint32]*Player
 	_startedAt int64
+
+	// pause fields
+	_pausedAt   int64 // unix ms, 0 if not paused
+	_resumeAt   int64 // unix ms, room clock is frozen until it
+	_pauseTeam  uint8
+	_pauseUsed  map[uint8]time.Duration
+	_pauseTimer *time.Timer
+
+	// input delay fields
+	_inputDelay uint32
+	_delayAt    int64 // unix ms of last evaluation
+
+	_startTimer *time.Timer
+
+	// conv => last frame of stopped players, for synthetic commands
+	_synthetic map[uint32]uint32
+
+	_gameOver   bool
+	_winner     uint8
+	_finishedAt time.Time
+	_results    map[uint32]PlayerSummary
+
+	_vote    *vote
+	_voteSeq uint32
 }
 
 func NewRoom(
 	roomId string,
 	duration time.Duration,
 	configs map[uint32]*PlayerConfig,
+	options RoomOptions,
 	chFinish chan<- string,
 ) *Room {
 	room := &Room{
@@ -43,6 +212,9 @@ func NewRoom(
 		duration:  duration,
 		maxFrame:  uint32(duration.Seconds()) * FPS,
 		configs:   configs,
+		roster:    newRoster(configs),
+		options:   options,
+		timeouts:  options.Timeouts.resolve(),
 		chFinish:  chFinish,
 
 		_mutex:     sync.RWMutex{},
@@ -50,13 +222,51 @@ func NewRoom(
 		_readySet:  make(map[uint32]bool, len(configs)),
 		_players:   make(map[uint32]*Player, len(configs)),
 		_startedAt: 0,
+
+		_pausedAt:  0,
+		_resumeAt:  0,
+		_pauseUsed: make(map[uint8]time.Duration, 4),
+
+		_inputDelay: 0,
+		_delayAt:    0,
+
+		_synthetic: nil,
+
+		_results: make(map[uint32]PlayerSummary, len(configs)),
 	}
 
 	room.logInfo(LogFields{
-		"duration": duration,
-		"configs":  configs,
+		"duration":         duration,
+		"configs":          configs,
+		"mode":             options.Mode,
+		"min_players":      options.MinPlayers,
+		"min_team_players": options.MinTeamPlayers,
+		"synthesize":       options.SynthesizeInputs,
+		"visibility":       options.Visibility,
+		"seed":             options.Seed,
+		"settings":         options.Settings,
+		"timeouts":         room.timeouts,
 	}, "create room")
 
+	policy, err := NewVisibility(&options)
+	if err != nil {
+		room.logInfo(LogFields{"error": err.Error()}, "fallback visibility")
+		policy = TeamDelayed{}
+	}
+	room.policy = policy
+	room.progress = newProgress(room.roster)
+	room.observer = options.Observer
+	if room.observer == nil {
+		room.observer = NopObserver{}
+	}
+	if options.Simulator != nil {
+		room.sim = newSimulation(options.Simulator, room.roster)
+	}
+
+	if options.Quorum() && !InUnitTest {
+		room._startTimer = time.AfterFunc(time.Until(room.createdAt.Add(room.timeouts.Start)), room.startByQuorum)
+	}
+
 	return room
 }
 
@@ -68,6 +278,10 @@ func (r *Room) CreatedAt() time.Time {
 	return r.createdAt
 }
 
+func (r *Room) Timeouts() Timeouts {
+	return r.timeouts
+}
+
 func (r *Room) MaxFrame() uint32 {
 	return r.maxFrame
 }
@@ -76,6 +290,26 @@ func (r *Room) StartedAt() time.Time {
 	return time.UnixMilli(atomic.LoadInt64(&r._startedAt))
 }
 
+// Now returns the room clock, which is frozen while paused or counting down to resume.
+func (r *Room) Now() time.Time {
+	if pausedAt := atomic.LoadInt64(&r._pausedAt); pausedAt != 0 {
+		return time.UnixMilli(pausedAt)
+	}
+	now := time.Now()
+	if resumeAt := time.UnixMilli(atomic.LoadInt64(&r._resumeAt)); now.Before(resumeAt) {
+		return resumeAt
+	}
+	return now
+}
+
+func (r *Room) Paused() bool {
+	return atomic.LoadInt64(&r._pausedAt) != 0
+}
+
+func (r *Room) Validator() CommandValidator {
+	return r.options.Validator
+}
+
 func (r *Room) MaxPlayers() int {
 	return len(r.configs)
 }
@@ -90,6 +324,70 @@ func (r *Room) GetPlayers(players []*Player) []*Player {
 	return players
 }
 
+func (r *Room) GetPlayer(conv uint32) *Player {
+	r._mutex.RLock()
+	defer r._mutex.RUnlock()
+
+	return r._players[conv]
+}
+
+func (r *Room) Summary() *RoomSummary {
+	r._mutex.RLock()
+	defer r._mutex.RUnlock()
+
+	summary := &RoomSummary{
+		RoomId:     r.roomId,
+		Mode:       r.options.Mode,
+		CreatedAt:  r.createdAt,
+		FinishedAt: r._finishedAt,
+		WinnerTeam: r._winner,
+		Players:    make([]PlayerSummary, 0, len(r.roster)),
+	}
+	if startedAt := atomic.LoadInt64(&r._startedAt); startedAt != 0 {
+		summary.StartedAt = time.UnixMilli(startedAt)
+	}
+	for _, player := range r.roster {
+		result, ok := r._results[player.Conv]
+		if !ok {
+			result = PlayerSummary{
+				Conv:     player.Conv,
+				PlayerId: player.PlayerId,
+				Team:     uint8(player.Team),
+			}
+		}
+		summary.Players = append(summary.Players, result)
+	}
+	return summary
+}
+
+func (r *Room) Stats() *RoomStats {
+	r._mutex.RLock()
+	state := r._state
+	r._mutex.RUnlock()
+
+	var players []*Player
+	players = r.GetPlayers(players)
+	stats := &RoomStats{
+		RoomId:     r.roomId,
+		State:      state,
+		CreatedAt:  r.createdAt,
+		StartedAt:  r.StartedAt(),
+		Paused:     r.Paused(),
+		InputDelay: r.InputDelay(),
+		Players:    make([]PlayerStats, 0, len(players)),
+	}
+	for _, player := range players {
+		playerStats := player.Stats()
+		playerStats.Lags = r.progress.distribution(player.Conv())
+		stats.Players = append(stats.Players, playerStats)
+	}
+	if state == RoomRunning {
+		progress := r.Progress()
+		stats.Frame, stats.Slowest = progress.Frame, progress.Slowest
+	}
+	return stats
+}
+
 func (r *Room) Enter(session ISession) error {
 	r.logInfo(LogFields{"conv": session.GetConv()}, "enter room")
 
@@ -140,6 +438,11 @@ func (r *Room) Connect(conv uint32) (running bool, err error) {
 	}
 	if ready {
 		atomic.StoreInt64(&r._startedAt, time.Now().UnixMilli())
+		r.initInputDelay()
+		r.observer.RoomStarted(r.roomId)
+		if !InUnitTest {
+			go r.reportProgress()
+		}
 	}
 	return ready, nil
 }
@@ -163,6 +466,97 @@ func (r *Room) connect(conv uint32) (running bool, err error) {
 	return false, nil
 }
 
+func (r *Room) netStart() *msg.NetStart {
+	return &msg.NetStart{
+		StartTime:  r.StartedAt().UnixMilli(),
+		InputDelay: r.InputDelay(),
+		Players:    r.roster,
+		Seed:       r.options.Seed,
+		Settings:   r.options.Settings,
+	}
+}
+
+// startByQuorum starts the room without absent players on the start timeout,
+// or finishes all players if the quorum isn't reached.
+func (r *Room) startByQuorum() {
+	ready, late, absent, err := r.quorumStart()
+	if err != nil {
+		r.logInfo(LogFields{"error": err.Error()}, "quorum failed")
+		r.Publish(&msg.NetFinish{
+			Frame: 0,
+			Cause: msg.NetFinishCause_OtherPlayer,
+		})
+		return
+	}
+	if ready == nil {
+		return // started by all players
+	}
+
+	atomic.StoreInt64(&r._startedAt, time.Now().UnixMilli())
+	r.initInputDelay()
+	r.logInfo(LogFields{"absent": absent}, "start by quorum")
+	r.observer.RoomStarted(r.roomId)
+	if !InUnitTest {
+		go r.reportProgress()
+	}
+	for _, conv := range absent {
+		r.Abandon(conv, 0)
+	}
+
+	for _, player := range late {
+		player.deliver(&msg.NetFinish{
+			Frame: 0,
+			Cause: msg.NetFinishCause_NetworkBroken,
+		})
+	}
+	start := r.netStart()
+	for _, player := range ready {
+		for _, conv := range absent {
+			player.deliver(&msg.NetState{
+				Conv:  conv,
+				State: msg.NetPlayerState_Stopped,
+			})
+		}
+		player.deliver(start)
+	}
+}
+
+func (r *Room) quorumStart() (ready []*Player, late []*Player, absent []uint32, err error) {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomIniting {
+		return nil, nil, nil, nil
+	}
+
+	teams := make(map[uint8]int, 4)
+	for _, config := range r.configs {
+		teams[config.Team] += 0
+		player := r._players[config.Conv]
+		if player != nil && r._readySet[config.Conv] && player.loadState() != msg.NetPlayerState_Stopped {
+			ready = append(ready, player)
+			teams[config.Team]++
+			continue
+		}
+		if player != nil {
+			late = append(late, player)
+		}
+		absent = append(absent, config.Conv)
+	}
+
+	if len(ready) == 0 || len(ready) < r.options.MinPlayers {
+		return nil, nil, nil, errors.WithStack(ErrNoQuorum)
+	}
+	for _, count := range teams {
+		if count < r.options.MinTeamPlayers {
+			return nil, nil, nil, errors.WithStack(ErrNoQuorum)
+		}
+	}
+
+	r._state = RoomRunning
+	return ready, late, absent, nil
+}
+
 func (r *Room) Leave(conv uint32) error {
 	r.logInfo(LogFields{"conv": conv}, "leave room")
 
@@ -171,6 +565,11 @@ func (r *Room) Leave(conv uint32) error {
 		return err
 	}
 	if stopped {
+		if closer, ok := r.options.Simulator.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				r.logWarn(nil, err)
+			}
+		}
 		r.chFinish <- r.roomId
 	}
 	return nil
@@ -180,9 +579,17 @@ func (r *Room) leave(conv uint32) (stopped bool, err error) {
 	r._mutex.Lock()
 	defer r._mutex.Unlock()
 
-	if _, ok := r._players[conv]; !ok {
+	player, ok := r._players[conv]
+	if !ok {
 		return false, errors.WithStack(ErrPlayerNotFound)
 	}
+	r._results[conv] = PlayerSummary{
+		Conv:     conv,
+		PlayerId: player.PlayerId(),
+		Team:     player.config.Team,
+		Frame:    atomic.LoadUint32(&player.frame),
+		Cause:    player.cause.String(),
+	}
 	delete(r._players, conv)
 	delete(r._readySet, conv)
 
@@ -190,9 +597,368 @@ func (r *Room) leave(conv uint32) (stopped bool, err error) {
 		return false, nil
 	}
 	r._state = RoomStopped
+	r._finishedAt = time.Now()
+	r.clearVote()
+	if r._pauseTimer != nil {
+		r._pauseTimer.Stop()
+		r._pauseTimer = nil
+	}
+	if r._startTimer != nil {
+		r._startTimer.Stop()
+		r._startTimer = nil
+	}
 	return true, nil
 }
 
+func (r *Room) Pause(conv uint32) error {
+	return r.pauseBy(conv, false)
+}
+
+// pauseBy pauses the room for the team of the player, extend grants the team an extra
+// PauseBudget, capped to a full budget, only if the room is paused.
+func (r *Room) pauseBy(conv uint32, extend bool) error {
+	duration, err := r.pause(conv, extend)
+	if err != nil {
+		return err
+	}
+	r.logInfo(LogFields{"conv": conv, "duration": duration}, "pause room")
+
+	r.Publish(&msg.NetPause{
+		Conv:     conv,
+		Duration: uint32(duration.Milliseconds()),
+	})
+	return nil
+}
+
+func (r *Room) pause(conv uint32, extend bool) (time.Duration, error) {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomRunning {
+		return 0, errors.WithStack(ErrRoomState)
+	}
+	config := r.configs[conv]
+	if config == nil {
+		return 0, errors.WithStack(ErrPlayerNotFound)
+	}
+	now := time.Now()
+	if r._pausedAt != 0 || now.UnixMilli() < r._resumeAt {
+		return 0, errors.WithStack(ErrRoomState)
+	}
+	used := r._pauseUsed[config.Team]
+	if extend {
+		used -= PauseBudget
+		if used < 0 {
+			used = 0
+		}
+	}
+	budget := PauseBudget - used
+	if budget <= 0 {
+		return 0, errors.WithStack(ErrPauseBudget)
+	}
+	r._pauseUsed[config.Team] = used
+
+	atomic.StoreInt64(&r._pausedAt, now.UnixMilli())
+	r._pauseTeam = config.Team
+	r._pauseTimer = time.AfterFunc(budget, func() {
+		if err := r.Resume(0); err != nil && !errors.Is(err, ErrRoomState) {
+			r.logInfo(LogFields{"error": err.Error()}, "auto resume")
+		}
+	})
+	return budget, nil
+}
+
+// Resume restarts the room clock after a countdown, conv is 0 if the pause budget runs out.
+func (r *Room) Resume(conv uint32) error {
+	err := r.resume(conv)
+	if err != nil {
+		return err
+	}
+	r.logInfo(LogFields{"conv": conv, "countdown": ResumeCountdown}, "resume room")
+
+	r.Publish(&msg.NetResume{
+		Conv:      conv,
+		Countdown: uint32(ResumeCountdown.Milliseconds()),
+	})
+	return nil
+}
+
+func (r *Room) resume(conv uint32) error {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomRunning || r._pausedAt == 0 {
+		return errors.WithStack(ErrRoomState)
+	}
+	if conv != 0 && r.configs[conv] == nil {
+		return errors.WithStack(ErrPlayerNotFound)
+	}
+	// only the pausing team can resume before its budget runs out
+	if conv != 0 && r.configs[conv].Team != r._pauseTeam {
+		return errors.WithStack(ErrPauseTeam)
+	}
+
+	now := time.Now().UnixMilli()
+	r._pauseUsed[r._pauseTeam] += time.Duration(now-r._pausedAt) * time.Millisecond
+	resumeAt := now + ResumeCountdown.Milliseconds()
+	atomic.AddInt64(&r._startedAt, resumeAt-r._pausedAt)
+	atomic.StoreInt64(&r._resumeAt, resumeAt)
+	atomic.StoreInt64(&r._pausedAt, 0)
+	if r._pauseTimer != nil {
+		r._pauseTimer.Stop()
+		r._pauseTimer = nil
+	}
+	return nil
+}
+
+// Frame returns the current frame by the room clock.
+func (r *Room) Frame() uint32 {
+	elapsed := r.Now().Sub(r.StartedAt())
+	if elapsed < 0 {
+		return 0
+	}
+	frame := uint32(elapsed / (time.Second / FPS))
+	if frame > r.maxFrame {
+		frame = r.maxFrame
+	}
+	return frame
+}
+
+// Abandon marks a player stopped in a running room, and synthesizes
+// empty commands after its last frame if the option is enabled.
+func (r *Room) Abandon(conv uint32, frame uint32) {
+	if r.sim != nil {
+		r.onSimulation(r.sim.abandon(conv, frame))
+	}
+	if !r.options.SynthesizeInputs {
+		return
+	}
+
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomRunning {
+		return
+	}
+	if r._synthetic == nil {
+		r._synthetic = make(map[uint32]uint32, len(r.configs))
+		if !InUnitTest {
+			go r.synthesize()
+		}
+	}
+	r._synthetic[conv] = frame
+}
+
+func (r *Room) synthesize() {
+	r.logInfo(nil, "start synthesize")
+	ticker := time.NewTicker(time.Second / FPS)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !r.synthesizeOnce() {
+			break
+		}
+	}
+	r.logInfo(nil, "finish synthesize")
+}
+
+func (r *Room) synthesizeOnce() bool {
+	buffers, running := r.synthesizeCommands()
+	if len(buffers) > 0 {
+		var players []*Player
+		players = r.GetPlayers(players)
+		for _, player := range players {
+			if _, ok := buffers[player.Conv()]; ok {
+				continue
+			}
+			for _, buffer := range buffers {
+				for _, buf := range buffer {
+					player.deliver(buf)
+				}
+			}
+		}
+	}
+	return running
+}
+
+func (r *Room) synthesizeCommands() (map[uint32][]*CommandBuffer, bool) {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomRunning {
+		return nil, false
+	}
+
+	current := r.Frame()
+	buffers := make(map[uint32][]*CommandBuffer, len(r._synthetic))
+	for conv, last := range r._synthetic {
+		for frame := last + 1; frame <= current; frame++ {
+			buffer, err := EncodeMessage(&msg.NetCommand{
+				Frame:     frame,
+				Conv:      conv,
+				Synthetic: true,
+			}, make([]byte, 0, 16))
+			if err != nil {
+				r.logInfo(LogFields{"error": err.Error()}, "synthesize command")
+				break
+			}
+			buffers[conv] = append(buffers[conv], &CommandBuffer{
+				Frame:      frame,
+				PlayerTeam: r.configs[conv].Team,
+				Buffer:     buffer,
+			})
+			r._synthetic[conv] = frame
+		}
+	}
+	return buffers, true
+}
+
+// CheckOutcome finishes all players with GameOver, when only one team has running players.
+// It's called by the goroutine of a player, so it sends without blocking.
+func (r *Room) CheckOutcome() {
+	winner, over := r.decideOutcome()
+	if over {
+		r.publishOutcome(winner)
+	}
+}
+
+// EndGame finishes all running players with GameOver, winner 0 means a draw.
+func (r *Room) EndGame(winner uint8) {
+	r._mutex.Lock()
+	over := r._state == RoomRunning && !r._gameOver
+	if over {
+		r._gameOver = true
+		r._winner = winner
+	}
+	r._mutex.Unlock()
+
+	if over {
+		r.publishOutcome(winner)
+	}
+}
+
+func (r *Room) publishOutcome(winner uint8) {
+	r.logInfo(LogFields{"winner_team": winner}, "game over")
+
+	frame := r.Frame()
+	var players []*Player
+	players = r.GetPlayers(players)
+	for _, player := range players {
+		if player.loadState() == msg.NetPlayerState_Stopped {
+			continue
+		}
+		outcome := msg.NetOutcome_Defeat
+		if winner == 0 {
+			outcome = msg.NetOutcome_Draw
+		} else if player.config.Team == winner {
+			outcome = msg.NetOutcome_Victory
+		}
+		player.deliver(&msg.NetFinish{
+			Frame:      frame,
+			Cause:      msg.NetFinishCause_GameOver,
+			Outcome:    outcome,
+			WinnerTeam: uint32(winner),
+		})
+	}
+}
+
+func (r *Room) decideOutcome() (winner uint8, over bool) {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomRunning || r._gameOver {
+		return 0, false
+	}
+
+	// team => has running players, absent players are eliminated
+	teams := make(map[uint8]bool, 4)
+	for conv, config := range r.configs {
+		player := r._players[conv]
+		running := player != nil && player.loadState() != msg.NetPlayerState_Stopped
+		teams[config.Team] = teams[config.Team] || running
+	}
+	if len(teams) < 2 {
+		return 0, false
+	}
+
+	count := 0
+	for team, running := range teams {
+		if running {
+			winner = team
+			count++
+		}
+	}
+	if count != 1 {
+		return 0, false
+	}
+	r._gameOver = true
+	r._winner = winner
+	return winner, true
+}
+
+func (r *Room) InputDelay() uint32 {
+	return atomic.LoadUint32(&r._inputDelay)
+}
+
+// initInputDelay guesses the delay by round trip times measured before start.
+func (r *Room) initInputDelay() {
+	var latency time.Duration
+	var players []*Player
+	players = r.GetPlayers(players)
+	for _, player := range players {
+		if l := player.RTT() + player.Jitter()*2; l > latency {
+			latency = l
+		}
+	}
+	delay := recommendDelay(latency)
+	atomic.StoreUint32(&r._inputDelay, delay)
+	atomic.StoreInt64(&r._delayAt, time.Now().UnixMilli())
+	r.logInfo(LogFields{"input_delay": delay}, "init input delay")
+}
+
+// UpdateInputDelay re-evaluates the delay by command arrival at most once per InputDelayInterval,
+// and publishes it to all players if changed.
+func (r *Room) UpdateInputDelay() {
+	if r.InputDelay() == 0 {
+		return // not started
+	}
+	now := time.Now().UnixMilli()
+	last := atomic.LoadInt64(&r._delayAt)
+	if now-last < InputDelayInterval.Milliseconds() || !atomic.CompareAndSwapInt64(&r._delayAt, last, now) {
+		return
+	}
+
+	var latency time.Duration
+	var players []*Player
+	players = r.GetPlayers(players)
+	for _, player := range players {
+		if player.loadState() != msg.NetPlayerState_Running {
+			continue
+		}
+		if l := player.InputLatency(); l > latency {
+			latency = l
+		}
+	}
+
+	current := r.InputDelay()
+	delay := applyHysteresis(current, recommendDelay(latency))
+	if delay == current {
+		return
+	}
+	atomic.StoreUint32(&r._inputDelay, delay)
+	r.logInfo(LogFields{"input_delay": delay, "latency": latency}, "update input delay")
+	r.Publish(&msg.NetInputDelay{Frames: delay})
+}
+
+// Publish sends a message to all players in the room without blocking,
+// it may be called by the goroutine of a player in the room.
+func (r *Room) Publish(message interface{}) {
+	var players []*Player
+	players = r.GetPlayers(players)
+	for _, player := range players {
+		player.deliver(message)
+	}
+}
+
 func (r *Room) Close() {
 	r.logInfo(nil, "close room")
 
@@ -203,6 +969,66 @@ func (r *Room) Close() {
 	}
 }
 
+// Simulate feeds a relayed command to the simulator.
+func (r *Room) Simulate(conv uint32, frame uint32, payload []byte) {
+	if r.sim != nil {
+		r.onSimulation(r.sim.push(conv, frame, payload))
+	}
+}
+
+// VerifyHash compares a client hash with the simulator, returns ErrDataOutOfSync
+// on mismatch if the room finishes desynchronized players.
+func (r *Room) VerifyHash(conv uint32, frame uint32, hash []byte) error {
+	if r.sim == nil || r.sim.verify(conv, frame, hash) {
+		return nil
+	}
+	r.flagDesync(conv, frame)
+	if r.options.FinishOnDesync {
+		return errors.Wrapf(ErrDataOutOfSync, "frame(%d)", frame)
+	}
+	return nil
+}
+
+func (r *Room) onSimulation(result simResult, err error) {
+	if err != nil {
+		r.logWarn(nil, err)
+	}
+	if result.over {
+		r.EndGame(result.winner)
+	}
+	for _, d := range result.desyncs {
+		r.flagDesync(d.conv, d.frame)
+		if !r.options.FinishOnDesync {
+			continue
+		}
+		player := r.GetPlayer(d.conv)
+		if player != nil && player.loadState() == msg.NetPlayerState_Running {
+			player.deliver(&msg.NetFinish{
+				Frame:         d.frame,
+				Cause:         msg.NetFinishCause_DataOutOfSync,
+				Code:          msg.NetFinishCode_CodeHashMismatch,
+				Detail:        "hash differs from the simulator",
+				ReceivedFrame: d.frame,
+			})
+		}
+	}
+}
+
+func (r *Room) flagDesync(conv uint32, frame uint32) {
+	atomic.AddUint64(&stats.HashMismatches, 1)
+	r.logWarn(LogFields{"conv": conv, "frame": frame}, "hash mismatch")
+	r.observer.HashMismatch(r.roomId, conv, frame)
+}
+
+func (r *Room) logWarn(fields LogFields, args ...interface{}) {
+	if fields == nil {
+		fields = LogFields{}
+	}
+	fields["source"] = "Room"
+	fields["room_id"] = r.roomId
+	LogPrint(LevelWarn, fields, args...)
+}
+
 func (r *Room) logInfo(fields LogFields, args ...interface{}) {
 	if fields == nil {
 		fields = LogFields{}
@@ -2,6 +2,8 @@ package core
 
 import (
 	. "point-set/base"
+	. "point-set/codec"
+	msg "point-set/message"
 	"testing"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 var (
 	tRid  = "mock-room-id"
 	tDura = time.Minute * 15
+	tOpts = RoomOptions{}
 	tChan = make(chan string, 10)
 
 	tCfg1 = &PlayerConfig{
@@ -32,14 +35,14 @@ var (
 )
 
 func TestNewRoom(t *testing.T) {
-	room := NewRoom(tRid, tDura, tCfgs, tChan)
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
 	assert.True(t, time.Since(room.CreatedAt()) < time.Millisecond)
 	assert.Equal(t, uint32(tDura.Seconds())*FPS, room.MaxFrame())
 	assert.Equal(t, time.UnixMilli(0), room.StartedAt())
 }
 
 func TestRoomEnter(t *testing.T) {
-	room := NewRoom(tRid, tDura, tCfgs, tChan)
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
 
 	err := room.Enter(nil)
 	assert.ErrorIs(t, err, ErrArguments)
@@ -65,7 +68,7 @@ func TestRoomEnter(t *testing.T) {
 }
 
 func TestRoomConnect(t *testing.T) {
-	room := NewRoom(tRid, tDura, tCfgs, tChan)
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
 	s1 := &MockSession{}
 	s1.On("GetConv").Return(uint32(123))
 	s2 := &MockSession{}
@@ -97,7 +100,7 @@ func TestRoomConnect(t *testing.T) {
 }
 
 func TestRoomLeave(t *testing.T) {
-	room := NewRoom(tRid, tDura, tCfgs, tChan)
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
 	s1 := &MockSession{}
 	s1.On("GetConv").Return(uint32(123))
 	s2 := &MockSession{}
@@ -126,3 +129,329 @@ func TestRoomLeave(t *testing.T) {
 	assert.Equal(t, 0, len(room._readySet))
 	assert.Equal(t, "mock-room-id", <-tChan)
 }
+
+// enterRoom adds the player of the session like Room.Enter, without starting the goroutine
+// of the player, which would race with the test and call the unmocked Recv of the session.
+func enterRoom(room *Room, session ISession) error {
+	_, err := room.enter(session)
+	return err
+}
+
+func TestRoomPause(t *testing.T) {
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	err := enterRoom(room, s1)
+	assert.Equal(t, nil, err)
+	player := room._players[123]
+
+	err = room.Pause(123)
+	assert.ErrorIs(t, err, ErrRoomState)
+
+	room._state = RoomRunning
+	room._startedAt = time.Now().Add(-time.Second).UnixMilli()
+	startedAt := room.StartedAt()
+
+	err = room.Pause(777)
+	assert.ErrorIs(t, err, ErrPlayerNotFound)
+	err = room.Resume(123)
+	assert.ErrorIs(t, err, ErrRoomState)
+
+	err = room.Pause(123)
+	assert.Equal(t, nil, err)
+	assert.True(t, room.Paused())
+	pause := (<-player.channel).(*msg.NetPause)
+	assert.Equal(t, uint32(123), pause.Conv)
+	assert.Equal(t, uint32(PauseBudget.Milliseconds()), pause.Duration)
+	err = room.Pause(123)
+	assert.ErrorIs(t, err, ErrRoomState)
+
+	time.Sleep(time.Millisecond * 20)
+	assert.True(t, time.Since(room.Now()) >= time.Millisecond*20)
+
+	err = room.Resume(456)
+	assert.ErrorIs(t, err, ErrPauseTeam)
+	assert.True(t, room.Paused())
+
+	err = room.Resume(123)
+	assert.Equal(t, nil, err)
+	assert.False(t, room.Paused())
+	resume := (<-player.channel).(*msg.NetResume)
+	assert.Equal(t, uint32(123), resume.Conv)
+	assert.Equal(t, uint32(ResumeCountdown.Milliseconds()), resume.Countdown)
+	assert.True(t, room.StartedAt().Sub(startedAt) >= ResumeCountdown+time.Millisecond*20)
+	assert.True(t, room.Now().After(time.Now().Add(ResumeCountdown-time.Millisecond*10)))
+	assert.True(t, room._pauseUsed[Team1] >= time.Millisecond*20)
+
+	err = room.Pause(123)
+	assert.ErrorIs(t, err, ErrRoomState)
+
+	room._resumeAt = 0
+	room._pauseUsed[Team1] = PauseBudget
+	err = room.Pause(123)
+	assert.ErrorIs(t, err, ErrPauseBudget)
+}
+
+func TestRoomStats(t *testing.T) {
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	err := enterRoom(room, s1)
+	assert.Equal(t, nil, err)
+
+	stats := room.Stats()
+	assert.Equal(t, tRid, stats.RoomId)
+	assert.Equal(t, RoomIniting, stats.State)
+	assert.Equal(t, 1, len(stats.Players))
+	assert.Equal(t, tCfg1.PlayerId, stats.Players[0].PlayerId)
+	assert.Equal(t, "Initing", stats.Players[0].State)
+}
+
+func TestRoomInputDelay(t *testing.T) {
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	err := enterRoom(room, s1)
+	assert.Equal(t, nil, err)
+	player := room._players[123]
+	player._rtt = int64(time.Millisecond * 250)
+	player._jitter = int64(time.Millisecond * 20)
+
+	room.UpdateInputDelay()
+	assert.Equal(t, uint32(0), room.InputDelay())
+
+	room.initInputDelay()
+	assert.Equal(t, uint32(3), room.InputDelay())
+
+	player.state = msg.NetPlayerState_Running
+	player._lag = int64(time.Millisecond * 400)
+	room.UpdateInputDelay()
+	assert.Equal(t, uint32(3), room.InputDelay())
+
+	room._delayAt = 0
+	room.UpdateInputDelay()
+	assert.Equal(t, uint32(6), room.InputDelay())
+	assert.Equal(t, uint32(6), (<-player.channel).(*msg.NetInputDelay).Frames)
+
+	room._delayAt = 0
+	player._lag = int64(time.Millisecond * 350)
+	room.UpdateInputDelay()
+	assert.Equal(t, uint32(6), room.InputDelay())
+	assert.Equal(t, 0, len(player.channel))
+
+	room._delayAt = 0
+	player._lag = int64(time.Millisecond * 150)
+	room.UpdateInputDelay()
+	assert.Equal(t, uint32(4), room.InputDelay())
+	assert.Equal(t, uint32(4), (<-player.channel).(*msg.NetInputDelay).Frames)
+
+	// a full channel drops the update instead of blocking the publisher
+	for len(player.channel) < cap(player.channel) {
+		player.channel <- &msg.NetPing{}
+	}
+	room._delayAt = 0
+	player._lag = int64(time.Millisecond * 400)
+	room.UpdateInputDelay()
+	assert.Equal(t, uint32(6), room.InputDelay())
+	assert.Equal(t, cap(player.channel), len(player.channel))
+}
+
+func TestRoomQuorum(t *testing.T) {
+	opts := RoomOptions{MinPlayers: 1}
+	assert.Equal(t, nil, opts.validate([]PlayerBasic{{Team: Team1}}))
+	opts = RoomOptions{MinPlayers: 2}
+	assert.ErrorIs(t, opts.validate([]PlayerBasic{{Team: Team1}}), ErrArguments)
+	opts = RoomOptions{MinTeamPlayers: 2}
+	assert.ErrorIs(t, opts.validate([]PlayerBasic{{Team: Team1}, {Team: Team1}, {Team: Team2}}), ErrArguments)
+
+	room := NewRoom(tRid, tDura, tCfgs, RoomOptions{MinTeamPlayers: 1}, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	err := enterRoom(room, s1)
+	assert.Equal(t, nil, err)
+	_, err = room.Connect(123)
+	assert.Equal(t, nil, err)
+	player1 := room._players[123]
+
+	room.startByQuorum()
+	assert.Equal(t, RoomIniting, room._state)
+	finish := (<-player1.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_OtherPlayer, finish.Cause)
+
+	room = NewRoom(tRid, tDura, tCfgs, RoomOptions{MinPlayers: 1}, tChan)
+	s2 := &MockSession{}
+	s2.On("GetConv").Return(uint32(456))
+	err = enterRoom(room, s1)
+	assert.Equal(t, nil, err)
+	err = enterRoom(room, s2)
+	assert.Equal(t, nil, err)
+	_, err = room.Connect(123)
+	assert.Equal(t, nil, err)
+	player1, player2 := room._players[123], room._players[456]
+
+	room.startByQuorum()
+	assert.Equal(t, RoomRunning, room._state)
+	assert.True(t, time.Since(room.StartedAt()) < time.Millisecond*10)
+	state := (<-player1.channel).(*msg.NetState)
+	assert.Equal(t, uint32(456), state.Conv)
+	assert.Equal(t, msg.NetPlayerState_Stopped, state.State)
+	start := (<-player1.channel).(*msg.NetStart)
+	assert.Equal(t, room.StartedAt().UnixMilli(), start.StartTime)
+	finish = (<-player2.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_NetworkBroken, finish.Cause)
+
+	room.startByQuorum()
+	assert.Equal(t, 0, len(player1.channel))
+}
+
+func TestRoomSynthesize(t *testing.T) {
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	room._state = RoomRunning
+	room.Abandon(456, 0)
+	assert.Equal(t, 0, len(room._synthetic))
+
+	room = NewRoom(tRid, tDura, tCfgs, RoomOptions{SynthesizeInputs: true}, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	s2 := &MockSession{}
+	s2.On("GetConv").Return(uint32(456))
+	assert.Equal(t, nil, enterRoom(room, s1))
+	assert.Equal(t, nil, enterRoom(room, s2))
+	player1 := room._players[123]
+	room._state = RoomRunning
+	room._startedAt = time.Now().Add(-time.Second / FPS * 3).UnixMilli()
+
+	room.Abandon(456, 1)
+	assert.Equal(t, uint32(3), room.Frame())
+	assert.True(t, room.synthesizeOnce())
+	for frame := uint32(2); frame <= 3; frame++ {
+		buf := (<-player1.channel).(*CommandBuffer)
+		assert.Equal(t, frame, buf.Frame)
+		assert.Equal(t, Team2, buf.PlayerTeam)
+		message, _, err := DecodeMessage(buf.Buffer)
+		assert.Equal(t, nil, err)
+		cmd := message.(*msg.NetCommand)
+		assert.Equal(t, frame, cmd.Frame)
+		assert.Equal(t, uint32(456), cmd.Conv)
+		assert.True(t, cmd.Synthetic)
+	}
+	assert.Equal(t, 0, len(room._players[456].channel))
+
+	assert.True(t, room.synthesizeOnce())
+	assert.Equal(t, 0, len(player1.channel))
+
+	room._state = RoomStopped
+	assert.False(t, room.synthesizeOnce())
+}
+
+func TestRoomRoster(t *testing.T) {
+	cfgs := map[uint32]*PlayerConfig{
+		456: tCfg2,
+		123: {PlayerId: "player-1", Team: Team1, Conv: 123, Metadata: []byte{1, 2, 3}},
+	}
+	room := NewRoom(tRid, tDura, cfgs, tOpts, tChan)
+	start := room.netStart()
+	assert.Equal(t, 2, len(start.Players))
+	assert.Equal(t, uint32(123), start.Players[0].Conv)
+	assert.Equal(t, "player-1", start.Players[0].PlayerId)
+	assert.Equal(t, uint32(Team1), start.Players[0].Team)
+	assert.Equal(t, []byte{1, 2, 3}, start.Players[0].Metadata)
+	assert.Equal(t, uint32(456), start.Players[1].Conv)
+	assert.Equal(t, 0, len(start.Players[1].Metadata))
+
+	players := []PlayerBasic{{PlayerId: "player-1", Team: Team1, Metadata: make([]byte, MaxPacketSize/2)}}
+	assert.Equal(t, nil, tOpts.validate(players))
+	players = append(players, PlayerBasic{PlayerId: "player-2", Team: Team2, Metadata: make([]byte, MaxPacketSize/2)})
+	assert.ErrorIs(t, tOpts.validate(players), ErrArguments)
+}
+
+func TestRoomOutcome(t *testing.T) {
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	s2 := &MockSession{}
+	s2.On("GetConv").Return(uint32(456))
+	assert.Equal(t, nil, enterRoom(room, s1))
+	assert.Equal(t, nil, enterRoom(room, s2))
+	_, err := room.Connect(123)
+	assert.Equal(t, nil, err)
+	_, err = room.Connect(456)
+	assert.Equal(t, nil, err)
+	player1, player2 := room._players[123], room._players[456]
+	player1.state = msg.NetPlayerState_Running
+	player2.state = msg.NetPlayerState_Running
+
+	room.CheckOutcome()
+	assert.Equal(t, 0, len(player1.channel))
+	assert.Equal(t, 0, len(player2.channel))
+
+	player1.state = msg.NetPlayerState_Stopped
+	room.CheckOutcome()
+	assert.Equal(t, 0, len(player1.channel))
+	finish := (<-player2.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_GameOver, finish.Cause)
+	assert.Equal(t, msg.NetOutcome_Victory, finish.Outcome)
+	assert.Equal(t, uint32(Team2), finish.WinnerTeam)
+
+	room.CheckOutcome()
+	assert.Equal(t, 0, len(player2.channel))
+
+	cfgs := map[uint32]*PlayerConfig{123: tCfg1, 789: {PlayerId: "player-3", Team: Team1, Conv: 789}}
+	room = NewRoom(tRid, tDura, cfgs, tOpts, tChan)
+	room._state = RoomRunning
+	room.CheckOutcome()
+	assert.False(t, room._gameOver)
+}
+
+func TestRoomSummary(t *testing.T) {
+	room := NewRoom(tRid, tDura, tCfgs, RoomOptions{Mode: "mode-1"}, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	assert.Equal(t, nil, enterRoom(room, s1))
+	player1 := room._players[123]
+	player1.frame = 99
+	player1.cause = msg.NetFinishCause_Surrender
+
+	assert.Equal(t, nil, room.Leave(123))
+	assert.Equal(t, tRid, <-tChan)
+	summary := room.Summary()
+	assert.Equal(t, tRid, summary.RoomId)
+	assert.Equal(t, "mode-1", summary.Mode)
+	assert.True(t, summary.StartedAt.IsZero())
+	assert.False(t, summary.FinishedAt.IsZero())
+	assert.Equal(t, []PlayerSummary{
+		{Conv: 123, PlayerId: "player-1", Team: Team1, Frame: 99, Cause: "Surrender"},
+		{Conv: 456, PlayerId: "player-2", Team: Team2},
+	}, summary.Players)
+}
+
+type eventObserver struct {
+	NopObserver
+	events []string
+}
+
+func (o *eventObserver) RoomStarted(roomId string) {
+	o.events = append(o.events, "started")
+}
+
+func (o *eventObserver) HashMismatch(roomId string, conv uint32, frame uint32) {
+	o.events = append(o.events, "mismatch")
+}
+
+func TestRoomObserver(t *testing.T) {
+	observer := &eventObserver{}
+	room := NewRoom(tRid, tDura, map[uint32]*PlayerConfig{123: tCfg1}, RoomOptions{Observer: observer}, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	err := enterRoom(room, s1)
+	assert.Equal(t, nil, err)
+
+	running, err := room.Connect(123)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, running)
+	room.flagDesync(123, 10)
+	assert.Equal(t, []string{"started", "mismatch"}, observer.events)
+
+	room = NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	assert.Equal(t, NopObserver{}, room.observer)
+}
@@ -0,0 +1,17 @@
+package core
+
+import msg "point-set/message"
+
+// Rules are the game rules of a room loaded at creation, e.g. a WebAssembly module.
+// They validate commands, follow the relayed command stream and judge the match.
+type Rules interface {
+	CommandValidator
+	Simulator
+	Referee
+	Close() error
+}
+
+// RulesLoader loads the rules by the name given at room creation.
+type RulesLoader interface {
+	Load(name string, start *msg.NetStart) (Rules, error)
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"bytes"
+	. "point-set/base"
+	msg "point-set/message"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type SimCommand struct {
+	Conv    uint32
+	Payload []byte
+}
+
+// Simulator is a server side reference simulation of a game mode, driven by the relayed commands.
+type Simulator interface {
+	// Step advances a frame with the commands of all players sorted by conv,
+	// an empty payload is given for stopped players. Returns the state hash of the frame,
+	// nil hash skips the verification of the frame.
+	Step(frame uint32, commands []SimCommand) ([]byte, error)
+}
+
+// Referee is optionally implemented by a Simulator to end the match, it's asked after each step.
+type Referee interface {
+	// Outcome returns whether the match is over after the frame, and the winner team, 0 means a draw.
+	Outcome(frame uint32) (winner uint8, over bool, err error)
+}
+
+// SimulatorFactory creates the simulator of a room, with the same roster, seed and settings sent to clients.
+type SimulatorFactory func(start *msg.NetStart) (Simulator, error)
+
+var (
+	simulatorsMutex sync.RWMutex
+	simulators      = make(map[string]SimulatorFactory)
+)
+
+// RegisterSimulator registers the simulator of a game mode, call it before creating rooms.
+func RegisterSimulator(mode string, factory SimulatorFactory) {
+	simulatorsMutex.Lock()
+	defer simulatorsMutex.Unlock()
+
+	if factory == nil {
+		delete(simulators, mode)
+	} else {
+		simulators[mode] = factory
+	}
+}
+
+// GetSimulator finds the simulator of a game mode, nil if not registered.
+func GetSimulator(mode string) SimulatorFactory {
+	simulatorsMutex.RLock()
+	defer simulatorsMutex.RUnlock()
+
+	return simulators[mode]
+}
+
+type desync struct {
+	conv  uint32
+	frame uint32
+}
+
+type simResult struct {
+	desyncs []desync
+	over    bool
+	winner  uint8
+}
+
+// simulation drives a Simulator in frame order, and compares the hashes reported by clients.
+type simulation struct {
+	simulator Simulator
+	convs     []uint32
+
+	_mutex     sync.Mutex
+	_frame     uint32                       // last simulated frame
+	_failed    bool                         // simulator returned an error, stop verifying
+	_over      bool                         // referee ended the match
+	_commands  map[uint32]map[uint32][]byte // frame => conv => payload
+	_abandoned map[uint32]uint32            // conv => last frame of stopped players
+	_hashes    map[uint32][]byte            // frame => server hash, in KCPWindowSize frames
+	_reports   map[uint32]map[uint32][]byte // frame => conv => client hash, not simulated yet
+}
+
+func newSimulation(simulator Simulator, roster []*msg.NetPlayer) *simulation {
+	convs := make([]uint32, 0, len(roster))
+	for _, player := range roster {
+		convs = append(convs, player.Conv)
+	}
+	return &simulation{
+		simulator: simulator,
+		convs:     convs,
+
+		_mutex:     sync.Mutex{},
+		_frame:     0,
+		_failed:    false,
+		_commands:  make(map[uint32]map[uint32][]byte, KCPWindowSize),
+		_abandoned: make(map[uint32]uint32, len(convs)),
+		_hashes:    make(map[uint32][]byte, KCPWindowSize),
+		_reports:   make(map[uint32]map[uint32][]byte, KCPWindowSize),
+	}
+}
+
+// push adds a command, and steps the simulator over all completed frames.
+func (s *simulation) push(conv uint32, frame uint32, payload []byte) (simResult, error) {
+	s._mutex.Lock()
+	defer s._mutex.Unlock()
+
+	if s._failed || frame <= s._frame {
+		return simResult{}, nil
+	}
+	if s._commands[frame] == nil {
+		s._commands[frame] = make(map[uint32][]byte, len(s.convs))
+	}
+	s._commands[frame][conv] = append([]byte(nil), payload...)
+	return s.step()
+}
+
+// abandon treats the commands after the frame of a stopped player as empty.
+func (s *simulation) abandon(conv uint32, frame uint32) (simResult, error) {
+	s._mutex.Lock()
+	defer s._mutex.Unlock()
+
+	if s._failed {
+		return simResult{}, nil
+	}
+	s._abandoned[conv] = frame
+	return s.step()
+}
+
+func (s *simulation) step() (result simResult, err error) {
+	referee, _ := s.simulator.(Referee)
+	commands := make([]SimCommand, 0, len(s.convs))
+	for {
+		frame := s._frame + 1
+		commands = commands[:0]
+		relayed := false
+		for _, conv := range s.convs {
+			payload, ok := s._commands[frame][conv]
+			if last, abandoned := s._abandoned[conv]; abandoned && frame > last {
+				payload, ok = nil, true
+			} else {
+				relayed = relayed || ok
+			}
+			if !ok {
+				return result, nil
+			}
+			commands = append(commands, SimCommand{conv, payload})
+		}
+		// all players are stopped
+		if !relayed {
+			return result, nil
+		}
+
+		hash, err := s.simulator.Step(frame, commands)
+		if err != nil {
+			s._failed = true
+			return result, errors.WithStack(err)
+		}
+		s._frame = frame
+		delete(s._commands, frame)
+		s._hashes[frame] = hash
+		delete(s._hashes, frame-KCPWindowSize)
+
+		for conv, report := range s._reports[frame] {
+			if hash != nil && !bytes.Equal(report, hash) {
+				result.desyncs = append(result.desyncs, desync{conv, frame})
+			}
+		}
+		delete(s._reports, frame)
+
+		if referee != nil && !s._over {
+			winner, over, err := referee.Outcome(frame)
+			if err != nil {
+				s._failed = true
+				return result, errors.WithStack(err)
+			}
+			if over {
+				s._over = true
+				result.over, result.winner = true, winner
+			}
+		}
+	}
+}
+
+// verify compares a client hash, returns false on mismatch. A hash ahead of the simulation
+// is kept until the frame is simulated, and hashes out of KCPWindowSize are ignored.
+func (s *simulation) verify(conv uint32, frame uint32, hash []byte) bool {
+	s._mutex.Lock()
+	defer s._mutex.Unlock()
+
+	if s._failed {
+		return true
+	}
+	if frame <= s._frame {
+		expected, ok := s._hashes[frame]
+		return !ok || expected == nil || bytes.Equal(expected, hash)
+	}
+	if frame > s._frame+KCPWindowSize {
+		return true
+	}
+	if s._reports[frame] == nil {
+		s._reports[frame] = make(map[uint32][]byte, len(s.convs))
+	}
+	s._reports[frame][conv] = append([]byte(nil), hash...)
+	return true
+}
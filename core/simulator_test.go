@@ -0,0 +1,154 @@
+package core
+
+import (
+	"errors"
+	. "point-set/base"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSimulator hashes a frame into the conv and first payload byte of each command, 0xff is invalid
+type mockSimulator struct {
+	frames []uint32
+}
+
+func (s *mockSimulator) Step(frame uint32, commands []SimCommand) ([]byte, error) {
+	s.frames = append(s.frames, frame)
+	hash := []byte{}
+	for _, cmd := range commands {
+		hash = append(hash, byte(cmd.Conv))
+		if len(cmd.Payload) > 0 {
+			if cmd.Payload[0] == 0xff {
+				return nil, errors.New("invalid payload")
+			}
+			hash = append(hash, cmd.Payload[0])
+		}
+	}
+	return hash, nil
+}
+
+type mockReferee struct {
+	mockSimulator
+}
+
+func (r *mockReferee) Outcome(frame uint32) (uint8, bool, error) {
+	return Team2, frame >= 2, nil
+}
+
+func TestSimulation(t *testing.T) {
+	sim := &mockSimulator{}
+	s := newSimulation(sim, []*msg.NetPlayer{{Conv: 1}, {Conv: 2}})
+
+	result, err := s.push(2, 1, []byte{20})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(result.desyncs))
+	assert.True(t, s.verify(1, 1, []byte{1, 10, 2, 20}))
+	assert.True(t, s.verify(2, 1, []byte{1, 11, 2, 20}))
+	assert.Equal(t, 0, len(sim.frames))
+
+	result, err = s.push(1, 1, []byte{10})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []desync{{2, 1}}, result.desyncs)
+	assert.Equal(t, []uint32{1}, sim.frames)
+	assert.True(t, s.verify(1, 1, []byte{1, 10, 2, 20}))
+	assert.False(t, s.verify(1, 1, []byte{1, 10, 2, 21}))
+
+	_, err = s.push(1, 2, []byte{12})
+	assert.Equal(t, nil, err)
+	_, err = s.push(1, 3, []byte{13})
+	assert.Equal(t, nil, err)
+	result, err = s.abandon(2, 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(result.desyncs))
+	assert.Equal(t, []uint32{1, 2, 3}, sim.frames)
+	assert.True(t, s.verify(2, 3, []byte{1, 13, 2}))
+
+	_, err = s.abandon(1, 4)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []uint32{1, 2, 3}, sim.frames)
+
+	s = newSimulation(sim, []*msg.NetPlayer{{Conv: 1}})
+	_, err = s.push(1, 1, []byte{0xff})
+	assert.Error(t, err)
+	assert.True(t, s._failed)
+	assert.True(t, s.verify(1, 1, []byte{}))
+}
+
+func TestRoomSimulation(t *testing.T) {
+	opts := RoomOptions{Simulator: &mockSimulator{}, FinishOnDesync: true}
+	room := NewRoom(tRid, tDura, tCfgs, opts, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	assert.Equal(t, nil, enterRoom(room, s1))
+	player1 := room._players[123]
+	player1.state = msg.NetPlayerState_Running
+
+	mismatches := GetStats().HashMismatches
+	assert.Equal(t, nil, room.VerifyHash(123, 1, []byte{123, 1}))
+	room.Simulate(456, 1, []byte{4})
+	room.Simulate(123, 1, []byte{1})
+	finish := (<-player1.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_DataOutOfSync, finish.Cause)
+	assert.Equal(t, uint32(1), finish.Frame)
+
+	err := room.VerifyHash(123, 1, []byte{123, 1})
+	assert.ErrorIs(t, err, ErrDataOutOfSync)
+	assert.Equal(t, nil, room.VerifyHash(123, 1, []byte{123, 1, 200, 4}))
+	assert.Equal(t, mismatches+2, GetStats().HashMismatches)
+}
+
+func TestRoomManagerSimulator(t *testing.T) {
+	mgr, err := NewRoomManager("127.0.0.1:12349", 0)
+	assert.Equal(t, nil, err)
+
+	var seed uint64
+	RegisterSimulator("sim-mode", func(start *msg.NetStart) (Simulator, error) {
+		seed = start.Seed
+		return &mockSimulator{}, nil
+	})
+	defer RegisterSimulator("sim-mode", nil)
+
+	_, err = mgr.CreateRoom("room-1", time.Minute, []PlayerBasic{{PlayerId: "p1"}}, RoomOptions{Mode: "sim-mode", Seed: 7})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(7), seed)
+	assert.True(t, mgr._rooms["room-1"].sim != nil)
+
+	RegisterSimulator("sim-mode", func(start *msg.NetStart) (Simulator, error) {
+		return nil, ErrArguments
+	})
+	_, err = mgr.CreateRoom("room-2", time.Minute, []PlayerBasic{{PlayerId: "p2"}}, RoomOptions{Mode: "sim-mode"})
+	assert.ErrorIs(t, err, ErrArguments)
+	assert.Equal(t, 1, mgr.allocator.Len())
+}
+
+func TestSimulationReferee(t *testing.T) {
+	s := newSimulation(&mockReferee{}, []*msg.NetPlayer{{Conv: 1}})
+	result, err := s.push(1, 1, nil)
+	assert.Equal(t, nil, err)
+	assert.False(t, result.over)
+	result, err = s.push(1, 2, nil)
+	assert.Equal(t, nil, err)
+	assert.True(t, result.over)
+	assert.Equal(t, Team2, result.winner)
+	result, err = s.push(1, 3, nil)
+	assert.Equal(t, nil, err)
+	assert.False(t, result.over)
+
+	room := NewRoom(tRid, tDura, tCfgs, tOpts, tChan)
+	s1 := &MockSession{}
+	s1.On("GetConv").Return(uint32(123))
+	assert.Equal(t, nil, enterRoom(room, s1))
+	player1 := room._players[123]
+	player1.state = msg.NetPlayerState_Running
+	room._state = RoomRunning
+
+	room.EndGame(0)
+	finish := (<-player1.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_GameOver, finish.Cause)
+	assert.Equal(t, msg.NetOutcome_Draw, finish.Outcome)
+	room.EndGame(Team1)
+	assert.Equal(t, 0, len(player1.channel))
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	. "point-set/base"
+	msg "point-set/message"
+	"time"
+)
+
+// driftTracker follows the drift of a player's frames from the room clock, and decides speed hints.
+type driftTracker struct {
+	advice  msg.NetSpeedAdvice
+	hintAt  time.Time
+	hints   int
+	samples int
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+// update records a drift, returns the advice and whether to send it. An advice is sent when
+// the drift passes the soft limits, repeated every SpeedHintInterval while drifting, and
+// withdrawn by KeepSpeed once the drift is back in half of the soft limits.
+func (d *driftTracker) update(drift time.Duration, low time.Duration, high time.Duration, now time.Time) (msg.NetSpeedAdvice, bool) {
+	if d.samples == 0 || drift < d.min {
+		d.min = drift
+	}
+	if d.samples == 0 || drift > d.max {
+		d.max = drift
+	}
+	d.samples++
+	d.sum += drift
+
+	advice := d.advice
+	if drift > high {
+		advice = msg.NetSpeedAdvice_SlowDown
+	} else if drift < -low {
+		advice = msg.NetSpeedAdvice_CatchUp
+	} else if drift < high/2 && drift > -low/2 {
+		advice = msg.NetSpeedAdvice_KeepSpeed
+	}
+
+	if advice == d.advice && (advice == msg.NetSpeedAdvice_KeepSpeed || now.Sub(d.hintAt) < SpeedHintInterval) {
+		return advice, false
+	}
+	d.advice = advice
+	d.hintAt = now
+	d.hints++
+	return advice, true
+}
+
+func (d *driftTracker) fields() LogFields {
+	fields := LogFields{
+		"drift_samples": d.samples,
+		"speed_hints":   d.hints,
+	}
+	if d.samples > 0 {
+		fields["drift_min"] = d.min.Milliseconds()
+		fields["drift_max"] = d.max.Milliseconds()
+		fields["drift_mean"] = (d.sum / time.Duration(d.samples)).Milliseconds()
+	}
+	return fields
+}
+
+// drift is the time of the player's frame minus the room clock, positive ahead.
+func (p *Player) drift() time.Duration {
+	remote := p.room.StartedAt().Add(time.Second / FPS * time.Duration(p.frame))
+	return remote.Sub(p.room.Now())
+}
+
+// hintSpeed sends a speed hint if the player drifts past the soft sync limits.
+func (p *Player) hintSpeed() error {
+	drift := p.drift()
+	timeouts := p.room.timeouts
+	advice, ok := p.drifts.update(drift, timeouts.SyncLow/SoftSyncDivisor, timeouts.SyncHigh/SoftSyncDivisor, time.Now())
+	if !ok {
+		return nil
+	}
+
+	frames := int32(drift / (time.Second / FPS))
+	p.logInfo(LogFields{
+		"advice": advice,
+		"drift":  drift.Milliseconds(),
+		"frames": frames,
+	}, "speed hint")
+	return p.sendToClient(&msg.NetSpeedHint{
+		Advice: advice,
+		Drift:  frames,
+	})
+}
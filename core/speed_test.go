@@ -0,0 +1,62 @@
+package core
+
+import (
+	. "point-set/base"
+	. "point-set/codec"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDriftTracker(t *testing.T) {
+	d := driftTracker{}
+	now := time.Now()
+	low, high := time.Second*2, time.Second
+
+	_, ok := d.update(time.Millisecond*100, low, high, now)
+	assert.False(t, ok)
+	advice, ok := d.update(time.Millisecond*1500, low, high, now)
+	assert.True(t, ok)
+	assert.Equal(t, msg.NetSpeedAdvice_SlowDown, advice)
+	_, ok = d.update(time.Millisecond*1500, low, high, now.Add(time.Millisecond*500))
+	assert.False(t, ok)
+	advice, ok = d.update(time.Millisecond*800, low, high, now.Add(SpeedHintInterval))
+	assert.True(t, ok)
+	assert.Equal(t, msg.NetSpeedAdvice_SlowDown, advice)
+	advice, ok = d.update(time.Millisecond*300, low, high, now.Add(SpeedHintInterval))
+	assert.True(t, ok)
+	assert.Equal(t, msg.NetSpeedAdvice_KeepSpeed, advice)
+	advice, ok = d.update(-time.Millisecond*2500, low, high, now.Add(SpeedHintInterval))
+	assert.True(t, ok)
+	assert.Equal(t, msg.NetSpeedAdvice_CatchUp, advice)
+
+	fields := d.fields()
+	assert.Equal(t, 6, fields["drift_samples"])
+	assert.Equal(t, 4, fields["speed_hints"])
+	assert.Equal(t, int64(-2500), fields["drift_min"])
+	assert.Equal(t, int64(1500), fields["drift_max"])
+	assert.Equal(t, int64(283), fields["drift_mean"])
+}
+
+func TestPlayerSpeedHint(t *testing.T) {
+	sess, room, player, _ := prepare()
+	player.state = msg.NetPlayerState_Running
+	room._startedAt = time.Now().Add(-time.Second * 10).UnixMilli()
+	player.frame = 69 // 3s behind, past the soft limit
+
+	hint, _ := EncodeMessage(&msg.NetSpeedHint{Advice: msg.NetSpeedAdvice_CatchUp, Drift: -30}, []byte{})
+	sess.On("Send", hint, mock.Anything).Return(len(hint), nil)
+	buffer, _ := EncodeMessage(&msg.NetCommand{Frame: 70}, []byte{})
+	err := player.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	sess.AssertCalled(t, "Send", hint, mock.Anything)
+	assert.Equal(t, 1, player.drifts.hints)
+
+	buffer, _ = EncodeMessage(&msg.NetCommand{Frame: 71}, []byte{})
+	err = player.handleKCP(buffer)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, player.drifts.hints)
+}
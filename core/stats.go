@@ -0,0 +1,32 @@
+package core
+
+import "sync/atomic"
+
+// Stats are process wide counters for monitoring.
+type Stats struct {
+	FloodBytes   uint64 `json:"flood_bytes"`
+	FloodPackets uint64 `json:"flood_packets"`
+	FloodPayload uint64 `json:"flood_payload"`
+
+	MessagesDropped uint64 `json:"messages_dropped"`
+
+	HashMismatches uint64 `json:"hash_mismatches"`
+
+	SlowReceivers uint64 `json:"slow_receivers"`
+}
+
+var stats Stats
+
+func GetStats() Stats {
+	return Stats{
+		FloodBytes:   atomic.LoadUint64(&stats.FloodBytes),
+		FloodPackets: atomic.LoadUint64(&stats.FloodPackets),
+		FloodPayload: atomic.LoadUint64(&stats.FloodPayload),
+
+		MessagesDropped: atomic.LoadUint64(&stats.MessagesDropped),
+
+		HashMismatches: atomic.LoadUint64(&stats.HashMismatches),
+
+		SlowReceivers: atomic.LoadUint64(&stats.SlowReceivers),
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	. "point-set/base"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeouts is the timeout profile of a room, in nanoseconds like the room duration.
+type Timeouts struct {
+	Connect  time.Duration `json:"connect"`   // since room creation, to connect and release convs
+	Start    time.Duration `json:"start"`     // since room creation, to start by quorum
+	SyncLow  time.Duration `json:"sync_low"`  // max lag of commands behind the room clock
+	SyncHigh time.Duration `json:"sync_high"` // max lead of commands ahead of the room clock
+}
+
+// resolve fills zero fields with the defaults in base.
+func (t Timeouts) resolve() Timeouts {
+	if t.Connect == 0 {
+		t.Connect = ConnectTimeout
+	}
+	if t.Start == 0 {
+		t.Start = StartTimeout
+	}
+	if t.SyncLow == 0 {
+		t.SyncLow = SyncLowLimit
+	}
+	if t.SyncHigh == 0 {
+		t.SyncHigh = SyncHighLimit
+	}
+	return t
+}
+
+func (t Timeouts) validate() error {
+	if t.Connect < MinTimeout || t.Connect > MaxConnectTimeout {
+		return errors.Wrapf(ErrArguments, "connect timeout(%s)", t.Connect)
+	}
+	if t.Start < t.Connect || t.Start > MaxStartTimeout {
+		return errors.Wrapf(ErrArguments, "start timeout(%s)", t.Start)
+	}
+	if t.SyncLow < MinTimeout || t.SyncLow > MaxSyncLowLimit {
+		return errors.Wrapf(ErrArguments, "sync low limit(%s)", t.SyncLow)
+	}
+	if t.SyncHigh < MinTimeout || t.SyncHigh > MaxSyncHighLimit {
+		return errors.Wrapf(ErrArguments, "sync high limit(%s)", t.SyncHigh)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	. "point-set/base"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeouts(t *testing.T) {
+	timeouts := Timeouts{}.resolve()
+	assert.Equal(t, Timeouts{ConnectTimeout, StartTimeout, SyncLowLimit, SyncHighLimit}, timeouts)
+	assert.Equal(t, nil, timeouts.validate())
+
+	timeouts = Timeouts{Start: time.Minute}.resolve()
+	assert.Equal(t, ConnectTimeout, timeouts.Connect)
+	assert.Equal(t, time.Minute, timeouts.Start)
+	assert.Equal(t, nil, timeouts.validate())
+
+	assert.ErrorIs(t, Timeouts{Connect: time.Millisecond}.resolve().validate(), ErrArguments)
+	assert.ErrorIs(t, Timeouts{Connect: time.Minute}.resolve().validate(), ErrArguments)
+	assert.ErrorIs(t, Timeouts{Start: MaxStartTimeout + 1}.resolve().validate(), ErrArguments)
+	assert.ErrorIs(t, Timeouts{SyncLow: -time.Second}.resolve().validate(), ErrArguments)
+	assert.ErrorIs(t, Timeouts{SyncHigh: MaxSyncHighLimit * 2}.resolve().validate(), ErrArguments)
+
+	players := []PlayerBasic{{PlayerId: "p1"}}
+	assert.Equal(t, nil, (&RoomOptions{Timeouts: Timeouts{Connect: time.Minute, Start: time.Minute * 2}}).validate(players))
+	assert.ErrorIs(t, (&RoomOptions{Timeouts: Timeouts{SyncLow: time.Hour}}).validate(players), ErrArguments)
+}
+
+func TestTimeoutsRoom(t *testing.T) {
+	options := RoomOptions{Timeouts: Timeouts{SyncLow: time.Second * 20, SyncHigh: time.Second * 5}}
+	room := NewRoom(tRid, tDura, tCfgs, options, tChan)
+	room._startedAt = time.Now().Add(-time.Second * 30).UnixMilli()
+	assert.Equal(t, ConnectTimeout, room.Timeouts().Connect)
+
+	player, err := NewPlayer(tCfg1, room, &MockSession{})
+	assert.Equal(t, nil, err)
+	player.frame = 150 // 15s behind, in the room's sync low limit
+	deadline, err := player.nextDealine()
+	assert.Equal(t, nil, err)
+	assert.InDelta(t, time.Second*20, time.Until(deadline), float64(time.Millisecond*100))
+	player.frame = 330 // 3s ahead, in the room's sync high limit
+	_, err = player.nextDealine()
+	assert.Equal(t, nil, err)
+	player.frame = 50 // 25s behind
+	_, err = player.nextDealine()
+	assert.ErrorIs(t, err, ErrTimeOutOfSync)
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	. "point-set/base"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CommandValidator checks the payload of a command before it's relayed.
+// Returns the payload to relay, an empty payload strips the command.
+// Returns an error to reject the command, the player will be finished with InvalidPacket.
+type CommandValidator interface {
+	Validate(config *PlayerConfig, frame uint32, payload []byte) ([]byte, error)
+}
+
+type ValidatorFunc func(config *PlayerConfig, frame uint32, payload []byte) ([]byte, error)
+
+func (f ValidatorFunc) Validate(config *PlayerConfig, frame uint32, payload []byte) ([]byte, error) {
+	return f(config, frame, payload)
+}
+
+var (
+	validatorsMutex sync.RWMutex
+	validators      = make(map[string]CommandValidator)
+)
+
+// RegisterValidator registers the validator of a game mode, call it before creating rooms.
+func RegisterValidator(mode string, validator CommandValidator) {
+	validatorsMutex.Lock()
+	defer validatorsMutex.Unlock()
+
+	if validator == nil {
+		delete(validators, mode)
+	} else {
+		validators[mode] = validator
+	}
+}
+
+// GetValidator finds the validator of a game mode, empty mode means no validation.
+func GetValidator(mode string) (CommandValidator, error) {
+	if mode == "" {
+		return nil, nil
+	}
+
+	validatorsMutex.RLock()
+	defer validatorsMutex.RUnlock()
+
+	validator, ok := validators[mode]
+	if !ok {
+		return nil, errors.Wrapf(ErrModeNotFound, "mode(%s)", mode)
+	}
+	return validator, nil
+}
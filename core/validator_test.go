@@ -0,0 +1,28 @@
+package core
+
+import (
+	. "point-set/base"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatorRegistry(t *testing.T) {
+	validator, err := GetValidator("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, validator)
+
+	_, err = GetValidator("mock-mode")
+	assert.ErrorIs(t, err, ErrModeNotFound)
+
+	RegisterValidator("mock-mode", ValidatorFunc(func(config *PlayerConfig, frame uint32, payload []byte) ([]byte, error) {
+		return payload, nil
+	}))
+	validator, err = GetValidator("mock-mode")
+	assert.Equal(t, nil, err)
+	assert.True(t, validator != nil)
+
+	RegisterValidator("mock-mode", nil)
+	_, err = GetValidator("mock-mode")
+	assert.ErrorIs(t, err, ErrModeNotFound)
+}
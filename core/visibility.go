@@ -0,0 +1,96 @@
+package core
+
+import (
+	. "point-set/base"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	VisibilityTeam     = "team"
+	VisibilityAll      = "all"
+	VisibilityDelay    = "delay"
+	VisibilityAlliance = "alliance"
+)
+
+// Visibility decides when a command is sent to a player.
+type Visibility interface {
+	// Release returns the receiver's frame to send the command at, 0 means immediately.
+	Release(senderTeam uint8, receiverTeam uint8, frame uint32) uint32
+}
+
+// AllImmediate sends all commands immediately, e.g. for co-op modes.
+type AllImmediate struct{}
+
+func (AllImmediate) Release(senderTeam uint8, receiverTeam uint8, frame uint32) uint32 {
+	return 0
+}
+
+// TeamDelayed sends same-team commands immediately, and holds other teams'
+// commands until the receiver catches up to the frame.
+type TeamDelayed struct{}
+
+func (TeamDelayed) Release(senderTeam uint8, receiverTeam uint8, frame uint32) uint32 {
+	if senderTeam == receiverTeam {
+		return 0
+	}
+	return frame
+}
+
+// FixedDelay holds other teams' commands until the receiver is N frames ahead of the frame.
+type FixedDelay struct {
+	Frames uint32
+}
+
+func (d FixedDelay) Release(senderTeam uint8, receiverTeam uint8, frame uint32) uint32 {
+	if senderTeam == receiverTeam {
+		return 0
+	}
+	return frame + d.Frames
+}
+
+// AllianceMatrix shares commands immediately between allied teams, others are team delayed.
+type AllianceMatrix struct {
+	allies map[uint8]map[uint8]bool
+}
+
+func NewAllianceMatrix(alliances [][]uint8) *AllianceMatrix {
+	allies := make(map[uint8]map[uint8]bool, 4)
+	for _, alliance := range alliances {
+		for _, team := range alliance {
+			if allies[team] == nil {
+				allies[team] = make(map[uint8]bool, len(alliance))
+			}
+			for _, ally := range alliance {
+				allies[team][ally] = true
+			}
+		}
+	}
+	return &AllianceMatrix{allies}
+}
+
+func (m *AllianceMatrix) Release(senderTeam uint8, receiverTeam uint8, frame uint32) uint32 {
+	if senderTeam == receiverTeam || m.allies[senderTeam][receiverTeam] {
+		return 0
+	}
+	return frame
+}
+
+// NewVisibility creates the visibility policy by room options, team delayed by default.
+func NewVisibility(options *RoomOptions) (Visibility, error) {
+	switch options.Visibility {
+	case "", VisibilityTeam:
+		return TeamDelayed{}, nil
+	case VisibilityAll:
+		return AllImmediate{}, nil
+	case VisibilityDelay:
+		if options.VisibilityDelay > MaxVisibilityDelay {
+			return nil, errors.Wrapf(ErrArguments, "visibility delay(%d)", options.VisibilityDelay)
+		}
+		return FixedDelay{options.VisibilityDelay}, nil
+	case VisibilityAlliance:
+		return NewAllianceMatrix(options.Alliances), nil
+	default:
+		return nil, errors.Wrapf(ErrArguments, "visibility(%s)", options.Visibility)
+	}
+}
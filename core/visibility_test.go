@@ -0,0 +1,48 @@
+package core
+
+import (
+	. "point-set/base"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVisibility(t *testing.T) {
+	assert.Equal(t, uint32(0), AllImmediate{}.Release(1, 2, 5))
+
+	assert.Equal(t, uint32(0), TeamDelayed{}.Release(1, 1, 5))
+	assert.Equal(t, uint32(5), TeamDelayed{}.Release(1, 2, 5))
+
+	assert.Equal(t, uint32(0), FixedDelay{3}.Release(1, 1, 5))
+	assert.Equal(t, uint32(8), FixedDelay{3}.Release(1, 2, 5))
+
+	matrix := NewAllianceMatrix([][]uint8{{1, 2}, {3, 4}})
+	assert.Equal(t, uint32(0), matrix.Release(1, 2, 5))
+	assert.Equal(t, uint32(0), matrix.Release(4, 3, 5))
+	assert.Equal(t, uint32(5), matrix.Release(1, 3, 5))
+	assert.Equal(t, uint32(0), matrix.Release(5, 5, 5))
+	assert.Equal(t, uint32(5), matrix.Release(5, 1, 5))
+}
+
+func TestNewVisibility(t *testing.T) {
+	policy, err := NewVisibility(&RoomOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, TeamDelayed{}, policy)
+
+	policy, err = NewVisibility(&RoomOptions{Visibility: VisibilityAll})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, AllImmediate{}, policy)
+
+	policy, err = NewVisibility(&RoomOptions{Visibility: VisibilityDelay, VisibilityDelay: 4})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, FixedDelay{4}, policy)
+	_, err = NewVisibility(&RoomOptions{Visibility: VisibilityDelay, VisibilityDelay: MaxVisibilityDelay + 1})
+	assert.ErrorIs(t, err, ErrArguments)
+
+	policy, err = NewVisibility(&RoomOptions{Visibility: VisibilityAlliance, Alliances: [][]uint8{{1, 2}}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(0), policy.Release(1, 2, 9))
+
+	_, err = NewVisibility(&RoomOptions{Visibility: "unknown"})
+	assert.ErrorIs(t, err, ErrArguments)
+}
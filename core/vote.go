@@ -0,0 +1,257 @@
+package core
+
+import (
+	. "point-set/base"
+	msg "point-set/message"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultVoteMajority = 0.5
+
+type vote struct {
+	id       uint32
+	kind     msg.NetVoteKind
+	conv     uint32
+	team     uint8 // 0 for room scope
+	deadline time.Time
+	voters   map[uint32]bool
+	ballots  map[uint32]bool // conv => agree
+	timer    *time.Timer
+}
+
+// required returns the count of agreements to pass the vote, more than the majority of voters.
+func (v *vote) required(majority float64) int {
+	if majority <= 0 {
+		majority = DefaultVoteMajority
+	}
+	required := int(float64(len(v.voters))*majority) + 1
+	if required > len(v.voters) {
+		required = len(v.voters)
+	}
+	return required
+}
+
+// resolve returns whether the vote is passed, and whether the result is determined.
+func (v *vote) resolve(majority float64, expired bool) (passed bool, done bool) {
+	agree, disagree := v.count()
+	required := v.required(majority)
+	if agree >= required {
+		return true, true
+	}
+	if expired || len(v.voters)-disagree < required {
+		return false, true
+	}
+	return false, false
+}
+
+func (v *vote) count() (agree int, disagree int) {
+	for _, ok := range v.ballots {
+		if ok {
+			agree++
+		} else {
+			disagree++
+		}
+	}
+	return agree, disagree
+}
+
+func (v *vote) result(passed bool) *msg.NetVoteResult {
+	agree, disagree := v.count()
+	return &msg.NetVoteResult{
+		VoteId:   v.id,
+		Kind:     v.kind,
+		Passed:   passed,
+		Agree:    uint32(agree),
+		Disagree: uint32(disagree),
+		Voters:   uint32(len(v.voters)),
+	}
+}
+
+// StartVote starts a vote by the player, the initiator agrees implicitly.
+func (r *Room) StartVote(conv uint32, kind msg.NetVoteKind) error {
+	v, err := r.startVote(conv, kind)
+	if err != nil {
+		return err
+	}
+	r.logInfo(LogFields{"conv": conv, "vote_id": v.id, "kind": kind, "team": v.team}, "start vote")
+
+	r.publishVoters(v, &msg.NetVote{
+		VoteId:   v.id,
+		Kind:     v.kind,
+		Conv:     v.conv,
+		Team:     uint32(v.team),
+		Deadline: v.deadline.UnixMilli(),
+	})
+	return r.CastBallot(conv, v.id, true)
+}
+
+func (r *Room) startVote(conv uint32, kind msg.NetVoteKind) (*vote, error) {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	if r._state != RoomRunning {
+		return nil, errors.WithStack(ErrRoomState)
+	}
+	config := r.configs[conv]
+	if config == nil {
+		return nil, errors.WithStack(ErrPlayerNotFound)
+	}
+	if r._vote != nil {
+		return nil, errors.WithStack(ErrVoteExisted)
+	}
+
+	var team uint8
+	switch kind {
+	case msg.NetVoteKind_VoteSurrender:
+		team = config.Team
+	case msg.NetVoteKind_VoteRemake:
+		if r.Now().Sub(r.StartedAt()) > RemakeWindow {
+			return nil, errors.WithStack(ErrRoomState)
+		}
+	case msg.NetVoteKind_VotePause:
+	default:
+		// VoteNone of an empty or old message must not start a surrender
+		return nil, errors.WithStack(ErrArguments)
+	}
+
+	voters := make(map[uint32]bool, len(r._players))
+	for conv, player := range r._players {
+		if (team == 0 || player.config.Team == team) &&
+			player.loadState() == msg.NetPlayerState_Running {
+			voters[conv] = true
+		}
+	}
+	voters[conv] = true
+
+	r._voteSeq++
+	v := &vote{
+		id:       r._voteSeq,
+		kind:     kind,
+		conv:     conv,
+		team:     team,
+		deadline: time.Now().Add(VoteTimeout),
+		voters:   voters,
+		ballots:  make(map[uint32]bool, len(voters)),
+	}
+	v.timer = time.AfterFunc(VoteTimeout, func() { r.expireVote(v.id) })
+	r._vote = v
+	return v, nil
+}
+
+// CastBallot records the ballot of a voter, and resolves the vote once the result is determined.
+func (r *Room) CastBallot(conv uint32, voteId uint32, agree bool) error {
+	v, passed, done, err := r.castBallot(conv, voteId, agree)
+	if err != nil {
+		return err
+	}
+
+	r.publishVoters(v, &msg.NetBallot{
+		VoteId: voteId,
+		Conv:   conv,
+		Agree:  agree,
+	})
+	if done {
+		r.finishVote(v, passed)
+	}
+	return nil
+}
+
+func (r *Room) castBallot(conv uint32, voteId uint32, agree bool) (*vote, bool, bool, error) {
+	r._mutex.Lock()
+	defer r._mutex.Unlock()
+
+	v := r._vote
+	if v == nil || v.id != voteId {
+		return nil, false, false, errors.WithStack(ErrVoteNotFound)
+	}
+	if !v.voters[conv] {
+		return nil, false, false, errors.WithStack(ErrPlayerNotFound)
+	}
+	if _, ok := v.ballots[conv]; ok {
+		return nil, false, false, errors.WithStack(ErrArguments)
+	}
+	v.ballots[conv] = agree
+
+	passed, done := v.resolve(r.options.VoteMajority, false)
+	if done {
+		r.clearVote()
+	}
+	return v, passed, done, nil
+}
+
+func (r *Room) expireVote(voteId uint32) {
+	r._mutex.Lock()
+	v := r._vote
+	if v == nil || v.id != voteId {
+		r._mutex.Unlock()
+		return
+	}
+	passed, _ := v.resolve(r.options.VoteMajority, true)
+	r.clearVote()
+	r._mutex.Unlock()
+
+	r.finishVote(v, passed)
+}
+
+// clearVote must be called with the lock held.
+func (r *Room) clearVote() {
+	if r._vote == nil {
+		return
+	}
+	if r._vote.timer != nil {
+		r._vote.timer.Stop()
+	}
+	r._vote = nil
+}
+
+func (r *Room) finishVote(v *vote, passed bool) {
+	result := v.result(passed)
+	r.logInfo(LogFields{
+		"vote_id":  v.id,
+		"kind":     v.kind,
+		"passed":   passed,
+		"agree":    result.Agree,
+		"disagree": result.Disagree,
+		"voters":   result.Voters,
+	}, "finish vote")
+	r.publishVoters(v, result)
+	if !passed {
+		return
+	}
+
+	switch v.kind {
+	case msg.NetVoteKind_VoteSurrender:
+		var players []*Player
+		players = r.GetPlayers(players)
+		for _, player := range players {
+			if player.config.Team == v.team && player.loadState() == msg.NetPlayerState_Running {
+				player.deliver(&msg.NetFinish{
+					Frame: r.Frame(),
+					Cause: msg.NetFinishCause_Surrender,
+				})
+			}
+		}
+	case msg.NetVoteKind_VoteRemake:
+		r.Publish(&msg.NetFinish{
+			Frame: r.Frame(),
+			Cause: msg.NetFinishCause_Remake,
+		})
+	case msg.NetVoteKind_VotePause:
+		if err := r.pauseBy(v.conv, true); err != nil {
+			r.logInfo(LogFields{"error": err.Error()}, "pause by vote")
+		}
+	}
+}
+
+// publishVoters sends the message to the players in the scope of the vote without blocking.
+func (r *Room) publishVoters(v *vote, message interface{}) {
+	var players []*Player
+	players = r.GetPlayers(players)
+	for _, player := range players {
+		if v.team == 0 || player.config.Team == v.team {
+			player.deliver(message)
+		}
+	}
+}
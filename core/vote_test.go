@@ -0,0 +1,175 @@
+package core
+
+import (
+	. "point-set/base"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoteResolve(t *testing.T) {
+	v := &vote{
+		voters:  map[uint32]bool{1: true, 2: true, 3: true, 4: true},
+		ballots: map[uint32]bool{},
+	}
+	assert.Equal(t, 3, v.required(0))
+	assert.Equal(t, 3, v.required(0.5))
+	assert.Equal(t, 2, v.required(0.25))
+	assert.Equal(t, 4, v.required(1))
+
+	v.ballots[1] = true
+	v.ballots[2] = true
+	passed, done := v.resolve(0, false)
+	assert.False(t, passed)
+	assert.False(t, done)
+	passed, done = v.resolve(0, true)
+	assert.False(t, passed)
+	assert.True(t, done)
+
+	v.ballots[3] = false
+	v.ballots[4] = false
+	passed, done = v.resolve(0, false)
+	assert.False(t, passed)
+	assert.True(t, done)
+
+	v.ballots[3] = true
+	passed, done = v.resolve(0, false)
+	assert.True(t, passed)
+	assert.True(t, done)
+}
+
+func prepareVote() (*Room, *Player, *Player, *Player) {
+	cfgs := map[uint32]*PlayerConfig{
+		123: tCfg1,
+		456: tCfg2,
+		789: {PlayerId: "player-3", Team: Team1, Conv: 789},
+	}
+	room := NewRoom(tRid, tDura, cfgs, tOpts, tChan)
+	room._state = RoomRunning
+	room._startedAt = time.Now().UnixMilli()
+	for conv, cfg := range cfgs {
+		player, err := NewPlayer(cfg, room, &MockSession{})
+		if err != nil {
+			panic(err)
+		}
+		player.state = msg.NetPlayerState_Running
+		room._players[conv] = player
+	}
+	return room, room._players[123], room._players[456], room._players[789]
+}
+
+func TestRoomVoteSurrender(t *testing.T) {
+	room, player1, player2, player3 := prepareVote()
+
+	err := room.StartVote(123, msg.NetVoteKind_VoteNone)
+	assert.ErrorIs(t, err, ErrArguments)
+	assert.Equal(t, 0, len(player1.channel))
+
+	err = room.StartVote(123, msg.NetVoteKind_VoteSurrender)
+	assert.Equal(t, nil, err)
+	err = room.StartVote(789, msg.NetVoteKind_VoteRemake)
+	assert.ErrorIs(t, err, ErrVoteExisted)
+	assert.Equal(t, 0, len(player2.channel))
+
+	start := (<-player3.channel).(*msg.NetVote)
+	assert.Equal(t, uint32(123), start.Conv)
+	assert.Equal(t, uint32(Team1), start.Team)
+	ballot := (<-player3.channel).(*msg.NetBallot)
+	assert.True(t, ballot.Agree)
+
+	err = room.CastBallot(456, start.VoteId, true)
+	assert.ErrorIs(t, err, ErrPlayerNotFound)
+	err = room.CastBallot(789, start.VoteId, true)
+	assert.Equal(t, nil, err)
+	err = room.CastBallot(789, start.VoteId, true)
+	assert.ErrorIs(t, err, ErrVoteNotFound)
+
+	<-player3.channel
+	result := (<-player3.channel).(*msg.NetVoteResult)
+	assert.True(t, result.Passed)
+	assert.Equal(t, uint32(2), result.Agree)
+	assert.Equal(t, uint32(2), result.Voters)
+	finish := (<-player3.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_Surrender, finish.Cause)
+	assert.Equal(t, 5, len(player1.channel))
+	assert.Equal(t, 0, len(player2.channel))
+	assert.Equal(t, (*vote)(nil), room._vote)
+}
+
+func TestRoomVoteRemake(t *testing.T) {
+	room, _, player2, _ := prepareVote()
+
+	err := room.StartVote(123, msg.NetVoteKind_VoteRemake)
+	assert.Equal(t, nil, err)
+	voteId := room._vote.id
+	err = room.CastBallot(456, voteId, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, voteId, room._vote.id)
+
+	room.expireVote(voteId)
+	assert.Equal(t, (*vote)(nil), room._vote)
+	assert.IsType(t, &msg.NetVote{}, <-player2.channel)
+	assert.IsType(t, &msg.NetBallot{}, <-player2.channel)
+	assert.IsType(t, &msg.NetBallot{}, <-player2.channel)
+	result := (<-player2.channel).(*msg.NetVoteResult)
+	assert.False(t, result.Passed)
+	assert.Equal(t, uint32(3), result.Voters)
+	assert.Equal(t, 0, len(player2.channel))
+
+	err = room.StartVote(123, msg.NetVoteKind_VoteRemake)
+	assert.Equal(t, nil, err)
+	err = room.CastBallot(456, room._vote.id, true)
+	assert.Equal(t, nil, err)
+	for i := 0; i < 3; i++ {
+		<-player2.channel
+	}
+	assert.True(t, (<-player2.channel).(*msg.NetVoteResult).Passed)
+	finish := (<-player2.channel).(*msg.NetFinish)
+	assert.Equal(t, msg.NetFinishCause_Remake, finish.Cause)
+
+	room._startedAt = time.Now().Add(-RemakeWindow * 2).UnixMilli()
+	err = room.StartVote(123, msg.NetVoteKind_VoteRemake)
+	assert.ErrorIs(t, err, ErrRoomState)
+}
+
+func TestRoomVotePause(t *testing.T) {
+	room, player1, _, _ := prepareVote()
+	room._pauseUsed[Team1] = PauseBudget
+
+	err := room.StartVote(123, msg.NetVoteKind_VotePause)
+	assert.Equal(t, nil, err)
+	err = room.CastBallot(456, room._vote.id, true)
+	assert.Equal(t, nil, err)
+	assert.True(t, room.Paused())
+	assert.Equal(t, time.Duration(0), room._pauseUsed[Team1])
+	for i := 0; i < 4; i++ {
+		<-player1.channel
+	}
+	pause := (<-player1.channel).(*msg.NetPause)
+	assert.Equal(t, uint32(PauseBudget.Milliseconds()), pause.Duration)
+
+	// no extension without a pause
+	err = room.StartVote(123, msg.NetVoteKind_VotePause)
+	assert.Equal(t, nil, err)
+	err = room.CastBallot(456, room._vote.id, true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Duration(0), room._pauseUsed[Team1])
+	room._pauseTimer.Stop()
+
+	// the extension is capped to a full budget
+	room, player1, _, _ = prepareVote()
+	room._pauseUsed[Team1] = PauseBudget / 2
+	err = room.StartVote(123, msg.NetVoteKind_VotePause)
+	assert.Equal(t, nil, err)
+	err = room.CastBallot(456, room._vote.id, true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Duration(0), room._pauseUsed[Team1])
+	for i := 0; i < 4; i++ {
+		<-player1.channel
+	}
+	pause = (<-player1.channel).(*msg.NetPause)
+	assert.Equal(t, uint32(PauseBudget.Milliseconds()), pause.Duration)
+	room._pauseTimer.Stop()
+}
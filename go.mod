@@ -1,6 +1,6 @@
 module point-set
 
-go 1.15
+go 1.18
 
 require (
 	github.com/gorilla/mux v1.8.0
@@ -8,7 +8,9 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
+	github.com/tetratelabs/wazero v1.0.0
 	github.com/xtaci/kcp-go/v5 v5.6.1
+	go.etcd.io/bbolt v1.3.6
 	google.golang.org/protobuf v1.27.1
 )
 
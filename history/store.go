@@ -0,0 +1,128 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	. "point-set/base"
+	"point-set/core"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const MaxQueryLimit = 100
+
+var (
+	bucketRooms   = []byte("rooms")   // room key => summary json
+	bucketPlayers = []byte("players") // player id | 0 | room key => nil
+)
+
+// Store persists room summaries in a local bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketRooms); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketPlayers)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.WithStack(err)
+	}
+	return &Store{db}, nil
+}
+
+func (s *Store) Close() error {
+	return errors.WithStack(s.db.Close())
+}
+
+func (s *Store) Record(summary *core.RoomSummary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	key := roomKey(summary.FinishedAt, summary.RoomId)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketRooms).Put(key, data); err != nil {
+			return err
+		}
+		players := tx.Bucket(bucketPlayers)
+		for _, player := range summary.Players {
+			if err := players.Put(append(playerPrefix(player.PlayerId), key...), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+// Query returns the summaries of the player finished in [from, to], in time order.
+func (s *Store) Query(playerId string, from time.Time, to time.Time, limit int) ([]*core.RoomSummary, error) {
+	if to.Before(from) {
+		return nil, errors.WithStack(ErrArguments)
+	}
+	if limit <= 0 || limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+
+	prefix := playerPrefix(playerId)
+	summaries := make([]*core.RoomSummary, 0, 16)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rooms := tx.Bucket(bucketRooms)
+		cursor := tx.Bucket(bucketPlayers).Cursor()
+		start := append(prefix, timeKey(from)...)
+		for k, _ := cursor.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			key := k[len(prefix):]
+			if len(key) < 8 || int64(binary.BigEndian.Uint64(key)) > to.UnixNano() {
+				break
+			}
+			data := rooms.Get(key)
+			if data == nil {
+				continue
+			}
+			summary := &core.RoomSummary{}
+			if err := json.Unmarshal(data, summary); err != nil {
+				return err
+			}
+			summaries = append(summaries, summary)
+			if len(summaries) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return summaries, nil
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// room key: | finished at (8 bytes, big endian) | room id |
+func roomKey(finishedAt time.Time, roomId string) []byte {
+	return append(timeKey(finishedAt), roomId...)
+}
+
+func playerPrefix(playerId string) []byte {
+	prefix := make([]byte, 0, len(playerId)+1)
+	prefix = append(prefix, playerId...)
+	return append(prefix, 0)
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"path/filepath"
+	. "point-set/base"
+	"point-set/core"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "history.db"))
+	assert.Equal(t, nil, err)
+	defer store.Close()
+
+	base := time.Unix(1600000000, 0)
+	for idx, roomId := range []string{"room-1", "room-2", "room-3"} {
+		err = store.Record(&core.RoomSummary{
+			RoomId:     roomId,
+			FinishedAt: base.Add(time.Minute * time.Duration(idx)),
+			WinnerTeam: 1,
+			Players: []core.PlayerSummary{
+				{Conv: 1, PlayerId: "p1", Team: 1, Frame: 100, Cause: "GameOver"},
+				{Conv: 2, PlayerId: "p" + roomId, Team: 2, Frame: 90, Cause: "Surrender"},
+			},
+		})
+		assert.Equal(t, nil, err)
+	}
+
+	summaries, err := store.Query("p1", base, base.Add(time.Hour), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(summaries))
+	assert.Equal(t, "room-1", summaries[0].RoomId)
+	assert.Equal(t, "room-3", summaries[2].RoomId)
+	assert.Equal(t, uint32(90), summaries[0].Players[1].Frame)
+	assert.Equal(t, "Surrender", summaries[0].Players[1].Cause)
+
+	summaries, err = store.Query("p1", base.Add(time.Second), base.Add(time.Minute), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(summaries))
+	assert.Equal(t, "room-2", summaries[0].RoomId)
+
+	summaries, err = store.Query("p1", base, base.Add(time.Hour), 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(summaries))
+
+	summaries, err = store.Query("proom-3", base, base.Add(time.Hour), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(summaries))
+	summaries, err = store.Query("p", base, base.Add(time.Hour), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(summaries))
+
+	_, err = store.Query("p1", base, base.Add(-time.Hour), 0)
+	assert.ErrorIs(t, err, ErrArguments)
+}
@@ -5,27 +5,36 @@ import (
 	"fmt"
 	"net/http"
 	"point-set/base"
+	"point-set/cluster"
 	"point-set/core"
+	"point-set/history"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 )
 
-func startHttp(mgr *core.RoomManager) {
-	h := handler{mgr}
+func startHttp(mgr *core.RoomManager, clu *cluster.Cluster, store *history.Store) {
+	h := handler{mgr, clu, store}
 	r := mux.NewRouter()
 	r.HandleFunc("/create-room", h.createRoom).Methods("POST")
 	r.HandleFunc("/delete-room", h.deleteRoom).Methods("POST")
+	r.HandleFunc("/node-status", h.nodeStatus).Methods("GET")
+	r.HandleFunc("/stats", h.stats).Methods("GET")
+	r.HandleFunc("/room-stats", h.roomStats).Methods("GET")
+	r.HandleFunc("/history", h.history).Methods("GET")
 	http.Handle("/", r)
 
-	addr := "127.0.0.1:8080"
+	addr := clu.HTTPAddr()
 	base.LogPrint(base.LevelInfo, nil, fmt.Sprintf("start HTTP %s", addr))
 	http.ListenAndServe(addr, nil)
 }
 
 type handler struct {
-	mgr *core.RoomManager
+	mgr   *core.RoomManager
+	clu   *cluster.Cluster
+	store *history.Store
 }
 
 const success = "{\"success\":true}"
@@ -35,11 +44,13 @@ type createArgs struct {
 	RoomId   string             `json:"room_id"`
 	Duration time.Duration      `json:"duration"`
 	Configs  []core.PlayerBasic `json:"configs"`
+	core.RoomOptions
 }
 
 type createRet struct {
 	Success  bool                 `json:"success"`
 	RoomId   string               `json:"room_id"`
+	Addr     string               `json:"addr"`
 	Duration time.Duration        `json:"duration"`
 	Configs  []*core.PlayerConfig `json:"configs"`
 }
@@ -53,7 +64,20 @@ func (h handler) createRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cfgs, err := h.mgr.CreateRoom(args.RoomId, args.Duration, args.Configs)
+	if !cluster.IsForwarded(r) {
+		node := h.clu.Place(h.localStatus())
+		if !h.clu.IsLocal(node) {
+			h.forward(w, node.HTTPAddr, "/create-room", args)
+			return
+		}
+	}
+
+	cfgs, err := h.mgr.CreateRoom(args.RoomId, args.Duration, args.Configs, args.RoomOptions)
+	if errors.Is(err, base.ErrModeNotFound) || errors.Is(err, base.ErrArguments) {
+		http.Error(w, failure, http.StatusBadRequest)
+		base.LogPrint(base.LevelError, nil, err)
+		return
+	}
 	if err != nil {
 		http.Error(w, failure, http.StatusInternalServerError)
 		base.LogPrint(base.LevelError, nil, err)
@@ -63,6 +87,7 @@ func (h handler) createRoom(w http.ResponseWriter, r *http.Request) {
 	ret := createRet{
 		Success:  true,
 		RoomId:   args.RoomId,
+		Addr:     h.clu.KCPAddr(),
 		Duration: args.Duration,
 		Configs:  cfgs,
 	}
@@ -87,6 +112,14 @@ func (h handler) deleteRoom(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = h.mgr.DeleteRoom(args.RoomId)
+	if errors.Is(err, base.ErrRoomNotFound) {
+		if !cluster.IsForwarded(r) {
+			h.broadcast(w, "/delete-room", args)
+		} else {
+			http.Error(w, failure, http.StatusNotFound)
+		}
+		return
+	}
 	if err != nil {
 		http.Error(w, failure, http.StatusInternalServerError)
 		base.LogPrint(base.LevelError, nil, err)
@@ -96,3 +129,121 @@ func (h handler) deleteRoom(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(success))
 }
+
+func (h handler) nodeStatus(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(h.localStatus())
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, errors.WithStack(err))
+	}
+}
+
+func (h handler) stats(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(core.GetStats())
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, errors.WithStack(err))
+	}
+}
+
+func (h handler) roomStats(w http.ResponseWriter, r *http.Request) {
+	room, err := h.mgr.GetRoom(r.URL.Query().Get("room_id"))
+	if err != nil {
+		http.Error(w, failure, http.StatusNotFound)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(room.Stats())
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, errors.WithStack(err))
+	}
+}
+
+// history queries finished rooms by player_id, from and to in unix ms
+func (h handler) history(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		http.Error(w, failure, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, limit := int64(0), time.Now().UnixMilli(), 0
+	var err error
+	if v := query.Get("from"); v != "" {
+		from, err = strconv.ParseInt(v, 10, 64)
+	}
+	if v := query.Get("to"); v != "" && err == nil {
+		to, err = strconv.ParseInt(v, 10, 64)
+	}
+	if v := query.Get("limit"); v != "" && err == nil {
+		limit, err = strconv.Atoi(v)
+	}
+	playerId := query.Get("player_id")
+	if err != nil || playerId == "" {
+		http.Error(w, failure, http.StatusBadRequest)
+		return
+	}
+
+	summaries, err := h.store.Query(playerId, time.UnixMilli(from), time.UnixMilli(to), limit)
+	if errors.Is(err, base.ErrArguments) {
+		http.Error(w, failure, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(summaries)
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, errors.WithStack(err))
+	}
+}
+
+func (h handler) localStatus() *cluster.NodeStatus {
+	rooms, players := h.mgr.Load()
+	return h.clu.Status(rooms, players)
+}
+
+func (h handler) forward(w http.ResponseWriter, httpAddr string, path string, args interface{}) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, errors.WithStack(err))
+		return
+	}
+
+	code, data, err := h.clu.Forward(httpAddr, path, body)
+	if err != nil {
+		http.Error(w, failure, http.StatusBadGateway)
+		base.LogPrint(base.LevelError, nil, err)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func (h handler) broadcast(w http.ResponseWriter, path string, args interface{}) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		base.LogPrint(base.LevelError, nil, errors.WithStack(err))
+		return
+	}
+
+	code, data, err := h.clu.Broadcast(path, body)
+	if err != nil {
+		http.Error(w, failure, http.StatusBadGateway)
+		base.LogPrint(base.LevelError, nil, err)
+		return
+	}
+	if data == nil {
+		http.Error(w, failure, code)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -1,15 +1,34 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"point-set/base"
+	"point-set/cluster"
 	"point-set/core"
+	"point-set/history"
+	"point-set/rules"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	kcpAddr := flag.String("kcp", "127.0.0.1:10000", "KCP listen address")
+	httpAddr := flag.String("http", "127.0.0.1:8080", "HTTP listen address")
+	publicAddr := flag.String("public", "", "public KCP address advertised to clients (default -kcp)")
+	nodeId := flag.Uint("node-id", 0, "node id in [0, 255], unique in the cluster")
+	peers := flag.String("peers", "", "comma separated HTTP addresses of the cluster nodes")
+	peersFile := flag.String("peers-file", "", "file with HTTP addresses of the cluster nodes, one per line")
+	historyPath := flag.String("history", "", "match history database file, empty to disable")
+	rulesDir := flag.String("rules-dir", "", "directory of WebAssembly rule modules, empty to disable")
+	rulesTimeout := flag.Duration("rules-timeout", rules.DefaultCallTimeout, "max time of a call into a rule module")
+	flag.IntVar(&base.Limits.BytesPerSecond, "limit-bytes", base.Limits.BytesPerSecond, "max input bytes per second of a player, 0 for unlimited")
+	flag.IntVar(&base.Limits.PacketsPerFrame, "limit-packets", base.Limits.PacketsPerFrame, "max input packets per frame of a player, 0 for unlimited")
+	flag.IntVar(&base.Limits.MaxPayloadSize, "limit-payload", base.Limits.MaxPayloadSize, "max command payload size, 0 for unlimited")
+	flag.IntVar(&base.Limits.MessagesPerSecond, "limit-messages", base.Limits.MessagesPerSecond, "max out-of-band messages per second of a player, 0 for unlimited")
+	flag.Parse()
+
 	log.SetFormatter(&log.JSONFormatter{})
 	log.SetOutput(os.Stdout)
 	if base.InDebug {
@@ -18,8 +37,18 @@ func main() {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	addr := "127.0.0.1:10000"
-	mgr, err := core.NewRoomManager(addr)
+	if *publicAddr == "" {
+		*publicAddr = *kcpAddr
+	}
+	var discovery cluster.Discovery
+	if *peersFile != "" {
+		discovery = cluster.NewFileDiscovery(*peersFile)
+	} else {
+		discovery = cluster.ParseStaticDiscovery(*peers)
+	}
+	clu := cluster.NewCluster(uint32(*nodeId), *publicAddr, *httpAddr, discovery)
+
+	mgr, err := core.NewRoomManager(*kcpAddr, uint32(*nodeId))
 	if err != nil {
 		panic(err)
 	}
@@ -27,9 +56,26 @@ func main() {
 		mgr.CreateTestRoom()
 	}
 
-	go startHttp(mgr)
+	var store *history.Store
+	if *historyPath != "" {
+		store, err = history.OpenStore(*historyPath)
+		if err != nil {
+			panic(err)
+		}
+		defer store.Close()
+		mgr.SetRecorder(store)
+	}
+
+	if *rulesDir != "" {
+		loader := rules.NewLoader(*rulesDir)
+		loader.SetCallTimeout(*rulesTimeout)
+		defer loader.Close()
+		mgr.SetRulesLoader(loader)
+	}
+
+	go startHttp(mgr, clu, store)
 
-	base.LogPrint(base.LevelInfo, nil, fmt.Sprintf("start KCP %s", addr))
+	base.LogPrint(base.LevelInfo, nil, fmt.Sprintf("start KCP %s", *kcpAddr))
 	err = mgr.Listen()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,343 @@
+// Package rules loads game rules from WebAssembly modules, sandboxed by wazero.
+//
+// A module imports nothing, and exports a memory with the optional functions below.
+// Bytes are passed by a pointer from alloc, they are valid only during the call.
+// Only a non-zero code of validate rejects a command. A trap or a call over the call
+// timeout fails the instance, then commands are accepted without validation and the
+// simulation stops, the room goes on.
+// A changed module file is compiled again for new rooms.
+//
+//	alloc(size i32) i32                                          required with bytes
+//	init(seed i64, players i32, settings i32, len i32)
+//	validate(conv i32, team i32, frame i32, payload i32, len i32) i32  non-zero rejects
+//	command(conv i32, frame i32, payload i32, len i32)          relayed, by frame and conv
+//	step(frame i32) i64                                          state hash, 0 means no hash
+//	outcome(frame i32) i32                                       -1 goes on, 0 draw, or winner team
+package rules
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "point-set/base"
+	"point-set/core"
+	msg "point-set/message"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	MemoryLimitPages   = 256 // 16 MiB
+	DefaultCallTimeout = time.Millisecond * 100
+)
+
+// signatures of the exports, by name
+var signatures = map[string][2][]api.ValueType{
+	"alloc":    {{api.ValueTypeI32}, {api.ValueTypeI32}},
+	"init":     {{api.ValueTypeI64, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}, {}},
+	"validate": {{api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI32}},
+	"command":  {{api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}, {}},
+	"step":     {{api.ValueTypeI32}, {api.ValueTypeI64}},
+	"outcome":  {{api.ValueTypeI32}, {api.ValueTypeI32}},
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type compiledModule struct {
+	modTime  time.Time
+	size     int64
+	compiled wazero.CompiledModule
+}
+
+// Loader compiles modules in a directory by name, the file is "<name>.wasm".
+type Loader struct {
+	dir         string
+	runtime     wazero.Runtime
+	callTimeout time.Duration
+
+	// multi-thread fields
+	_mutex    sync.Mutex
+	_compiled map[string]compiledModule
+	_seq      uint64
+}
+
+func NewLoader(dir string) *Loader {
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(MemoryLimitPages).
+		WithCloseOnContextDone(true)
+	return &Loader{
+		dir:         dir,
+		runtime:     wazero.NewRuntimeWithConfig(context.Background(), config),
+		callTimeout: DefaultCallTimeout,
+
+		_mutex:    sync.Mutex{},
+		_compiled: make(map[string]compiledModule, 16),
+		_seq:      0,
+	}
+}
+
+// SetCallTimeout sets the max time of a call into a module, call it before loading.
+func (l *Loader) SetCallTimeout(timeout time.Duration) {
+	l.callTimeout = timeout
+}
+
+func (l *Loader) Load(name string, start *msg.NetStart) (core.Rules, error) {
+	if !namePattern.MatchString(name) {
+		return nil, errors.Wrapf(ErrArguments, "rules(%s)", name)
+	}
+	compiled, seq, err := l.compile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	config := wazero.NewModuleConfig().WithName(fmt.Sprintf("%s-%d", name, seq))
+	mod, err := l.runtime.InstantiateModule(ctx, compiled, config)
+	if err != nil {
+		return nil, errors.Wrapf(ErrArguments, "rules(%s) %s", name, err.Error())
+	}
+	module, err := newModule(name, mod, l.callTimeout, start)
+	if err != nil {
+		mod.Close(ctx)
+		return nil, err
+	}
+	return module, nil
+}
+
+func (l *Loader) compile(name string) (wazero.CompiledModule, uint64, error) {
+	l._mutex.Lock()
+	defer l._mutex.Unlock()
+
+	l._seq++
+	path := filepath.Join(l.dir, name+".wasm")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, errors.Wrapf(ErrModeNotFound, "rules(%s) %s", name, err.Error())
+	}
+	cached, ok := l._compiled[name]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.compiled, l._seq, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, errors.Wrapf(ErrModeNotFound, "rules(%s) %s", name, err.Error())
+	}
+	compiled, err := l.runtime.CompileModule(context.Background(), data)
+	if err != nil {
+		return nil, 0, errors.Wrapf(ErrArguments, "rules(%s) %s", name, err.Error())
+	}
+	// instances of the old module are still safe to call
+	if ok {
+		cached.compiled.Close(context.Background())
+	}
+	l._compiled[name] = compiledModule{info.ModTime(), info.Size(), compiled}
+	return compiled, l._seq, nil
+}
+
+func (l *Loader) Close() error {
+	return errors.WithStack(l.runtime.Close(context.Background()))
+}
+
+// Module is the rules of a room, calls are serialized as a module instance isn't thread safe.
+type Module struct {
+	name        string
+	mod         api.Module
+	callTimeout time.Duration
+	alloc       api.Function
+	validate    api.Function
+	command     api.Function
+	step        api.Function
+	outcome     api.Function
+
+	_mutex  sync.Mutex
+	_failed bool // failed by a trap or the call timeout
+}
+
+func newModule(name string, mod api.Module, callTimeout time.Duration, start *msg.NetStart) (*Module, error) {
+	for export, signature := range signatures {
+		fn := mod.ExportedFunction(export)
+		if fn == nil {
+			continue
+		}
+		def := fn.Definition()
+		if !equalTypes(def.ParamTypes(), signature[0]) || !equalTypes(def.ResultTypes(), signature[1]) {
+			return nil, errors.Wrapf(ErrArguments, "rules(%s) signature of %s", name, export)
+		}
+	}
+
+	m := &Module{
+		name:        name,
+		mod:         mod,
+		callTimeout: callTimeout,
+		alloc:       mod.ExportedFunction("alloc"),
+		validate:    mod.ExportedFunction("validate"),
+		command:     mod.ExportedFunction("command"),
+		step:        mod.ExportedFunction("step"),
+		outcome:     mod.ExportedFunction("outcome"),
+
+		_mutex:  sync.Mutex{},
+		_failed: false,
+	}
+	if mod.Memory() == nil || (m.alloc == nil && (m.validate != nil || m.command != nil)) {
+		return nil, errors.Wrapf(ErrArguments, "rules(%s) memory or alloc", name)
+	}
+
+	if fn := mod.ExportedFunction("init"); fn != nil {
+		ptr, err := m.write(start.Settings)
+		if err != nil {
+			return nil, err
+		}
+		_, err = m.call(fn, start.Seed, uint64(len(start.Players)), uint64(ptr), uint64(len(start.Settings)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Module) Validate(config *core.PlayerConfig, frame uint32, payload []byte) ([]byte, error) {
+	if m.validate == nil {
+		return payload, nil
+	}
+
+	m._mutex.Lock()
+	defer m._mutex.Unlock()
+
+	ptr, err := m.write(payload)
+	if err == nil {
+		var ret []uint64
+		ret, err = m.call(m.validate, uint64(config.Conv), uint64(config.Team), uint64(frame), uint64(ptr), uint64(len(payload)))
+		if err == nil {
+			if code := api.DecodeI32(ret[0]); code != 0 {
+				return nil, errors.Errorf("rules(%s) rejected(%d)", m.name, code)
+			}
+			return payload, nil
+		}
+	}
+	// a failed module doesn't kick players
+	return payload, nil
+}
+
+func (m *Module) Step(frame uint32, commands []core.SimCommand) ([]byte, error) {
+	m._mutex.Lock()
+	defer m._mutex.Unlock()
+
+	if m.command != nil {
+		for _, cmd := range commands {
+			ptr, err := m.write(cmd.Payload)
+			if err != nil {
+				return nil, err
+			}
+			_, err = m.call(m.command, uint64(cmd.Conv), uint64(frame), uint64(ptr), uint64(len(cmd.Payload)))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if m.step == nil {
+		return nil, nil
+	}
+	ret, err := m.call(m.step, uint64(frame))
+	if err != nil {
+		return nil, err
+	}
+	if ret[0] == 0 {
+		return nil, nil
+	}
+	hash := make([]byte, 8)
+	binary.BigEndian.PutUint64(hash, ret[0])
+	return hash, nil
+}
+
+func (m *Module) Outcome(frame uint32) (uint8, bool, error) {
+	if m.outcome == nil {
+		return 0, false, nil
+	}
+
+	m._mutex.Lock()
+	defer m._mutex.Unlock()
+
+	ret, err := m.call(m.outcome, uint64(frame))
+	if err != nil {
+		return 0, false, err
+	}
+	winner := api.DecodeI32(ret[0])
+	if winner < 0 {
+		return 0, false, nil
+	}
+	return uint8(winner), true, nil
+}
+
+func (m *Module) Close() error {
+	return errors.WithStack(m.mod.Close(context.Background()))
+}
+
+// write copies the bytes into the module memory, returns the pointer.
+func (m *Module) write(data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if m.alloc == nil {
+		return 0, errors.Wrapf(ErrArguments, "rules(%s) alloc", m.name)
+	}
+	ret, err := m.call(m.alloc, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	ptr := api.DecodeU32(ret[0])
+	if !m.mod.Memory().Write(ptr, data) {
+		m.fail(LogFields{"ptr": ptr, "size": len(data)}, "failed by alloc")
+		return 0, errors.Errorf("rules(%s) alloc out of range", m.name)
+	}
+	return ptr, nil
+}
+
+// call runs a function in the call timeout, the module fails on a trap or timeout.
+func (m *Module) call(fn api.Function, params ...uint64) ([]uint64, error) {
+	if m._failed {
+		return nil, errors.Errorf("rules(%s) failed", m.name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.callTimeout)
+	defer cancel()
+
+	ret, err := fn.Call(ctx, params...)
+	if err != nil {
+		if ctx.Err() != nil {
+			m.fail(LogFields{"timeout": m.callTimeout}, "failed by timeout")
+		} else {
+			m.fail(LogFields{"error": err.Error()}, "failed by trap")
+		}
+		return nil, errors.Wrapf(err, "rules(%s) %s", m.name, fn.Definition().Name())
+	}
+	return ret, nil
+}
+
+// fail marks the module failed, its state is lost.
+func (m *Module) fail(fields LogFields, args ...interface{}) {
+	m._failed = true
+	fields["source"] = "Rules"
+	fields["name"] = m.name
+	LogPrint(LevelWarn, fields, args...)
+}
+
+func equalTypes(a []api.ValueType, b []api.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
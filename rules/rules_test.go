@@ -0,0 +1,216 @@
+package rules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "point-set/base"
+	"point-set/core"
+	msg "point-set/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func section(id byte, items ...[]byte) []byte {
+	body := []byte{byte(len(items))}
+	for _, item := range items {
+		body = append(body, item...)
+	}
+	return append([]byte{id, byte(len(body))}, body...)
+}
+
+func export(name string, kind byte, idx byte) []byte {
+	return append(append([]byte{byte(len(name))}, name...), kind, idx)
+}
+
+func code(expr ...byte) []byte {
+	return append([]byte{byte(len(expr) + 1), 0}, expr...)
+}
+
+// sumModule sums payload lengths of commands, hashes by the sum and ends at frame 3 with team 2 winning.
+// validate rejects payloads longer than 4 bytes, traps on an 8 bytes payload and spins forever on a 9 bytes payload.
+func sumModule() []byte {
+	wasm := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	wasm = append(wasm, section(1,
+		[]byte{0x60, 1, 0x7f, 1, 0x7f},                         // (i32) i32
+		[]byte{0x60, 5, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 1, 0x7f}, // (i32 x5) i32
+		[]byte{0x60, 4, 0x7f, 0x7f, 0x7f, 0x7f, 0},             // (i32 x4)
+		[]byte{0x60, 1, 0x7f, 1, 0x7e},                         // (i32) i64
+	)...)
+	wasm = append(wasm, section(3, []byte{0}, []byte{1}, []byte{2}, []byte{3}, []byte{0})...)
+	wasm = append(wasm, section(5, []byte{0x00, 1})...)
+	wasm = append(wasm, section(6, []byte{0x7f, 0x01, 0x41, 0x00, 0x0b})...)
+	wasm = append(wasm, section(7,
+		export("memory", 2, 0),
+		export("alloc", 0, 0),
+		export("validate", 0, 1),
+		export("command", 0, 2),
+		export("step", 0, 3),
+		export("outcome", 0, 4),
+	)...)
+	wasm = append(wasm, section(10,
+		// i32.const 1024
+		code(0x41, 0x80, 0x08, 0x0b),
+		// if len == 8 { unreachable }; if len == 9 { loop { br 0 } }; len > 4
+		code(0x20, 0x04, 0x41, 0x08, 0x46, 0x04, 0x40, 0x00, 0x0b,
+			0x20, 0x04, 0x41, 0x09, 0x46, 0x04, 0x40, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b,
+			0x20, 0x04, 0x41, 0x04, 0x4b, 0x0b),
+		// sum += len
+		code(0x23, 0x00, 0x20, 0x03, 0x6a, 0x24, 0x00, 0x0b),
+		// i64(sum)
+		code(0x23, 0x00, 0xad, 0x0b),
+		// frame >= 3 ? 2 : -1
+		code(0x20, 0x00, 0x41, 0x03, 0x4f, 0x04, 0x7f, 0x41, 0x02, 0x05, 0x41, 0x7f, 0x0b, 0x0b),
+	)...)
+	return wasm
+}
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "sum.wasm"), sumModule(), 0644)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "broken.wasm"), []byte{1, 2, 3}, 0644)
+	assert.Equal(t, nil, err)
+
+	loader := NewLoader(dir)
+	defer loader.Close()
+
+	_, err = loader.Load("../sum", &msg.NetStart{})
+	assert.ErrorIs(t, err, ErrArguments)
+	_, err = loader.Load("unknown", &msg.NetStart{})
+	assert.ErrorIs(t, err, ErrModeNotFound)
+	_, err = loader.Load("broken", &msg.NetStart{})
+	assert.ErrorIs(t, err, ErrArguments)
+
+	rules1, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+	defer rules1.Close()
+	rules2, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+	defer rules2.Close()
+}
+
+func TestModule(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "sum.wasm"), sumModule(), 0644)
+	assert.Equal(t, nil, err)
+	loader := NewLoader(dir)
+	defer loader.Close()
+	rules, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+
+	config := &core.PlayerConfig{Conv: 1, Team: 1}
+	payload, err := rules.Validate(config, 1, []byte{1, 2, 3})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{1, 2, 3}, payload)
+	_, err = rules.Validate(config, 1, []byte{1, 2, 3, 4, 5})
+	assert.Error(t, err)
+
+	hash, err := rules.Step(1, []core.SimCommand{{Conv: 1, Payload: []byte{1, 2}}, {Conv: 2, Payload: []byte{3}}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 3}, hash)
+	_, over, err := rules.Outcome(1)
+	assert.Equal(t, nil, err)
+	assert.False(t, over)
+
+	hash, err = rules.Step(2, []core.SimCommand{{Conv: 1}, {Conv: 2}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 3}, hash)
+	winner, over, err := rules.Outcome(3)
+	assert.Equal(t, nil, err)
+	assert.True(t, over)
+	assert.Equal(t, uint8(2), winner)
+
+}
+
+func TestModuleTimeout(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "sum.wasm"), sumModule(), 0644)
+	assert.Equal(t, nil, err)
+	loader := NewLoader(dir)
+	loader.SetCallTimeout(time.Millisecond * 10)
+	defer loader.Close()
+	rules, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+
+	// the module spins and fails by the call timeout, commands are accepted
+	// without validation, and the simulation stops
+	config := &core.PlayerConfig{Conv: 1, Team: 1}
+	payload, err := rules.Validate(config, 1, make([]byte, 9))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, make([]byte, 9), payload)
+	payload, err = rules.Validate(config, 1, []byte{1, 2, 3, 4, 5})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, payload)
+	_, err = rules.Step(1, nil)
+	assert.Error(t, err)
+	_, _, err = rules.Outcome(1)
+	assert.Error(t, err)
+
+	// other rooms are not affected
+	other, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+	_, err = other.Validate(config, 1, []byte{1, 2, 3, 4, 5})
+	assert.Error(t, err)
+}
+
+func TestModuleTrap(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "sum.wasm"), sumModule(), 0644)
+	assert.Equal(t, nil, err)
+	loader := NewLoader(dir)
+	defer loader.Close()
+	rules, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+
+	// only a non-zero code rejects, a trap fails the module like the call timeout
+	config := &core.PlayerConfig{Conv: 1, Team: 1}
+	payload, err := rules.Validate(config, 1, make([]byte, 8))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, make([]byte, 8), payload)
+	payload, err = rules.Validate(config, 1, []byte{1, 2, 3, 4, 5})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, payload)
+	_, err = rules.Step(1, nil)
+	assert.Error(t, err)
+}
+
+func TestModuleSignature(t *testing.T) {
+	dir := t.TempDir()
+	// outcome is (i32) without the result
+	wasm := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	wasm = append(wasm, section(1, []byte{0x60, 1, 0x7f, 0})...)
+	wasm = append(wasm, section(3, []byte{0})...)
+	wasm = append(wasm, section(5, []byte{0x00, 1})...)
+	wasm = append(wasm, section(7, export("memory", 2, 0), export("outcome", 0, 0))...)
+	wasm = append(wasm, section(10, code(0x0b))...)
+	err := ioutil.WriteFile(filepath.Join(dir, "bad.wasm"), wasm, 0644)
+	assert.Equal(t, nil, err)
+
+	loader := NewLoader(dir)
+	defer loader.Close()
+	_, err = loader.Load("bad", &msg.NetStart{})
+	assert.ErrorIs(t, err, ErrArguments)
+}
+
+func TestLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sum.wasm")
+	err := ioutil.WriteFile(path, sumModule(), 0644)
+	assert.Equal(t, nil, err)
+	loader := NewLoader(dir)
+	defer loader.Close()
+	rules, err := loader.Load("sum", &msg.NetStart{})
+	assert.Equal(t, nil, err)
+	defer rules.Close()
+
+	// a changed file is compiled again
+	err = ioutil.WriteFile(path, []byte{1, 2, 3}, 0644)
+	assert.Equal(t, nil, err)
+	err = os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	assert.Equal(t, nil, err)
+	_, err = loader.Load("sum", &msg.NetStart{})
+	assert.ErrorIs(t, err, ErrArguments)
+}